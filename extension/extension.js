@@ -0,0 +1,32 @@
+const vscode = require('vscode')
+const { LanguageClient } = require('vscode-languageclient/node')
+
+let client
+
+// Starts `luminary lsp` for the .lum files and runs `luminary debug` for the
+// luminary debug sessions, the path of the luminary binary can be changed
+// using the luminary.path setting
+function activate(context) {
+  const command = vscode.workspace.getConfiguration('luminary').get('path') || 'luminary'
+  context.subscriptions.push(
+    vscode.debug.registerDebugAdapterDescriptorFactory('luminary', {
+      createDebugAdapterDescriptor: () => new vscode.DebugAdapterExecutable(command, ['debug'])
+    })
+  )
+
+  const server = { command, args: ['lsp'] }
+
+  client = new LanguageClient(
+    'luminary',
+    'Luminary Language Server',
+    { run: server, debug: server },
+    { documentSelector: [{ scheme: 'file', language: 'luminary' }] }
+  )
+  context.subscriptions.push(client.start())
+}
+
+function deactivate() {
+  return client ? client.stop() : undefined
+}
+
+module.exports = { activate, deactivate }
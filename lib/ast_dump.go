@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+var positionType = reflect.TypeOf(&Position{})
+
+// DumpAST formats a node and its children as an indented tree, positions and
+// empty fields are left out
+func DumpAST(node interface{}) string {
+	var sb strings.Builder
+	dumpValue(&sb, reflect.ValueOf(node), 0)
+	return strings.TrimRight(sb.String(), "\n")
+}
+
+func dumpValue(sb *strings.Builder, v reflect.Value, depth int) {
+	indent := strings.Repeat("  ", depth)
+
+	if v.Kind() == reflect.Interface {
+		v = v.Elem()
+	}
+	if !v.IsValid() || (v.Kind() == reflect.Ptr && v.IsNil()) {
+		sb.WriteString("null\n")
+		return
+	}
+	if tok, ok := v.Interface().(*Token); ok {
+		sb.WriteString(tok.String() + "\n")
+		return
+	}
+
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.Elem().Kind() != reflect.Struct {
+			dumpValue(sb, v.Elem(), depth)
+			return
+		}
+		s := v.Elem()
+		sb.WriteString(s.Type().Name())
+
+		fields := []int{}
+		for i := 0; i < s.NumField(); i++ {
+			f := s.Field(i)
+			// DefaultText is a copy of the source, which isn't part of the tree
+			if f.Type() == positionType || s.Type().Field(i).Name == "DefaultText" || f.IsZero() || (f.Kind() == reflect.Slice && f.Len() == 0) {
+				continue
+			}
+			fields = append(fields, i)
+		}
+
+		// Nodes made of a single token are written on one line
+		if len(fields) == 1 && s.Field(fields[0]).Type() == reflect.TypeOf(&Token{}) {
+			sb.WriteString(" " + s.Field(fields[0]).Interface().(*Token).String() + "\n")
+			return
+		}
+
+		sb.WriteString("\n")
+		for _, i := range fields {
+			sb.WriteString(indent + "  " + s.Type().Field(i).Name + ": ")
+			dumpValue(sb, s.Field(i), depth + 1)
+		}
+	case reflect.Slice, reflect.Array:
+		sb.WriteString("\n")
+		for i := 0; i < v.Len(); i++ {
+			sb.WriteString(indent + "  - ")
+			dumpValue(sb, v.Index(i), depth + 2)
+		}
+	default:
+		sb.WriteString(fmt.Sprintf("%v\n", v.Interface()))
+	}
+}
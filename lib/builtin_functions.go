@@ -6,16 +6,17 @@ import (
 	"os"
 	"strconv"
 	"strings"
+	"unicode/utf8"
 )
 
 type BuiltinFunction struct {
 	Name string
 	ArgNames []string
-	OnCall func([]interface{}) *RuntimeResult
+	OnCall func([]interface{}, *Context) *RuntimeResult
 	StartPos, EndPos *Position
 }
 
-func NewBuiltinFunction(n string, a []string, oc func([]interface{}) *RuntimeResult) Value {
+func NewBuiltinFunction(n string, a []string, oc func([]interface{}, *Context) *RuntimeResult) Value {
 	f := &BuiltinFunction{
 		Name: n,
 		ArgNames: a,
@@ -37,6 +38,21 @@ func (f *BuiltinFunction) String() string {
 	return str
 }
 
+// Arity returns the least and the most number of arguments a builtin takes,
+// an argument name ending with '?' is optional and one starting with '...'
+// takes any number of arguments so the most is -1
+func (f *BuiltinFunction) Arity() (int, int) {
+	min, max := 0, len(f.ArgNames)
+	for _, arg := range f.ArgNames {
+		if strings.HasPrefix(arg, "...") {
+			max = -1
+		} else if !strings.HasSuffix(arg, "?") {
+			min++
+		}
+	}
+	return min, max
+}
+
 func (f *BuiltinFunction) SetPos(sp, ep *Position) Value {
 	f.StartPos = sp
 	f.EndPos = ep
@@ -96,28 +112,6 @@ func (f *BuiltinFunction) IsLessThanOrEqual(other interface{}) (Value, *Error) {
 	return nil, NewRuntimeError("Can't compare Builtinfunctions", f.StartPos, nil)
 }
 
-func (f *BuiltinFunction) And(other interface{}) (Value, *Error) {
-	if o, ok := other.(Value); ok {
-		if o.IsTrue() {
-			return o, nil
-		}
-		return NewNumber(0), nil
-	}
-
-	return nil, NewRuntimeError("Can't compare values of different types", f.StartPos, nil)
-}
-
-func (f *BuiltinFunction) Or(other interface{}) (Value, *Error) {
-	if o, ok := other.(Value); ok {
-		if o.IsTrue() {
-			return o, nil
-		}
-		return NewNumber(0), nil
-	}
-
-	return nil, NewRuntimeError("Can't compare values of different types", f.StartPos, nil)
-}
-
 func (f *BuiltinFunction) Not() Value {
 	return NewNumber(0)
 }
@@ -131,8 +125,19 @@ func (f *BuiltinFunction) GetVal() interface{} {
 }
 
 func (f *BuiltinFunction) Call(args []interface{}, ctx *Context) *RuntimeResult {
+	if ActiveProfile != nil {
+		ActiveProfile.Enter("builtin:" + f.Name)
+		defer ActiveProfile.Exit()
+	}
+
 	rr := NewRuntimeResult()
-	val := rr.Register(f.OnCall(args))
+	for _, arg := range args {
+		if kw, ok := arg.(*KeywordArg); ok {
+			return rr.Failure(NewRuntimeError(
+				fmt.Sprintf("%v doesn't accept keyword arguments, got '%v'", f, kw.Name), f.StartPos, f.EndPos))
+		}
+	}
+	val := rr.Register(f.OnCall(args, ctx))
 	if rr.ShouldReturn() {
 		return rr
 	}
@@ -148,7 +153,7 @@ func (f *BuiltinFunction) AccessElement(index int, to interface{}, ctx *Context)
 var BuiltinPrint = NewBuiltinFunction(
 	"print",
 	[]string{"...values"},
-	func(args []interface{}) *RuntimeResult {
+	func(args []interface{}, ctx *Context) *RuntimeResult {
 		rr := NewRuntimeResult()
 		fmt.Print(args...)
 		return rr.Success(NewNull())
@@ -158,7 +163,7 @@ var BuiltinPrint = NewBuiltinFunction(
 var BuiltinPrintln = NewBuiltinFunction(
 	"println",
 	[]string{"...values"},
-	func(args []interface{}) *RuntimeResult {
+	func(args []interface{}, ctx *Context) *RuntimeResult {
 		rr := NewRuntimeResult()
 		fmt.Println(args...)
 		return rr.Success(NewNull())
@@ -167,8 +172,8 @@ var BuiltinPrintln = NewBuiltinFunction(
 
 var BuiltinScan = NewBuiltinFunction(
 	"scan",
-	[]string{"prompt"},
-	func(args []interface{}) *RuntimeResult {
+	[]string{"prompt?"},
+	func(args []interface{}, ctx *Context) *RuntimeResult {
 		rr := NewRuntimeResult()
 
 		prompt := "> "
@@ -188,8 +193,11 @@ var BuiltinScan = NewBuiltinFunction(
 
 var BuiltinExit = NewBuiltinFunction(
 	"exit",
-	[]string{"code"},
-	func(args []interface{}) *RuntimeResult {
+	[]string{"code?"},
+	func(args []interface{}, ctx *Context) *RuntimeResult {
+		StopProfile()
+		StopCoverage()
+
 		var code interface{} = 0
 		if len(args) > 0 {
 			code = args[0]
@@ -210,8 +218,8 @@ var BuiltinExit = NewBuiltinFunction(
 // Lists
 var BuiltinLen = NewBuiltinFunction(
 	"len",
-	[]string{"list|string"},
-	func(args []interface{}) *RuntimeResult {
+	[]string{"list|string|map|range"},
+	func(args []interface{}, ctx *Context) *RuntimeResult {
 		rr := NewRuntimeResult()
 
 		if len(args) > 0 {
@@ -220,10 +228,15 @@ var BuiltinLen = NewBuiltinFunction(
 				case *List:
 					return rr.Success(val.Length)
 				case *String:
-					return rr.Success(NewNumber(float64(len(val.Value))))
+					// Strings are counted by their characters like each goes over them
+					return rr.Success(NewNumber(float64(utf8.RuneCountInString(val.Value))))
+				case *Map:
+					return rr.Success(NewNumber(float64(len(val.Keys))))
+				case *Range:
+					return rr.Success(NewNumber(float64(val.Len())))
 			}
 
-			return rr.Failure(NewRuntimeError("len() only works for strings or lists", nil, nil))
+			return rr.Failure(NewRuntimeError("len() only works for strings, lists, maps or ranges", nil, nil))
 		}
 
 		return rr.Failure(NewRuntimeError("Expected one argument to be passed to len()", nil, nil))
@@ -233,7 +246,7 @@ var BuiltinLen = NewBuiltinFunction(
 var BuiltinAppend = NewBuiltinFunction(
 	"append",
 	[]string{"list", "...elements"},
-	func(args []interface{}) *RuntimeResult {
+	func(args []interface{}, ctx *Context) *RuntimeResult {
 		rr := NewRuntimeResult()
 
 		if len(args) > 1 {
@@ -254,7 +267,7 @@ var BuiltinAppend = NewBuiltinFunction(
 var BuiltinPrepend = NewBuiltinFunction(
 	"prepend",
 	[]string{"list", "...elements"},
-	func(args []interface{}) *RuntimeResult {
+	func(args []interface{}, ctx *Context) *RuntimeResult {
 		rr := NewRuntimeResult()
 
 		if len(args) > 1 {
@@ -277,7 +290,7 @@ var BuiltinPrepend = NewBuiltinFunction(
 var BuiltinShift = NewBuiltinFunction(
 	"shift",
 	[]string{"list"},
-	func(args []interface{}) *RuntimeResult {
+	func(args []interface{}, ctx *Context) *RuntimeResult {
 		rr := NewRuntimeResult()
 
 		if len(args) > 0 {
@@ -298,7 +311,7 @@ var BuiltinShift = NewBuiltinFunction(
 var BuiltinPop = NewBuiltinFunction(
 	"pop",
 	[]string{"list"},
-	func(args []interface{}) *RuntimeResult {
+	func(args []interface{}, ctx *Context) *RuntimeResult {
 		rr := NewRuntimeResult()
 
 		if len(args) > 0 {
@@ -316,30 +329,51 @@ var BuiltinPop = NewBuiltinFunction(
 	},
 )
 
+// CallCallback calls fun with args, dropping the extra arguments a
+// non-variadic function doesn't declare, so callbacks like fun(x) = x * 2
+// can be passed where (value, index) is supplied
+func CallCallback(fun Value, args []interface{}, ctx *Context) *RuntimeResult {
+	if f, ok := fun.(*Function); ok && !f.IsVariadic() && len(args) > len(f.Params) {
+		args = args[:len(f.Params)]
+	}
+	return fun.Call(args, ctx)
+}
+
 var BuiltinMap = NewBuiltinFunction(
 	"map",
-	[]string{"list, fun"},
-	func(args []interface{}) *RuntimeResult {
+	[]string{"iterable", "fun"},
+	func(args []interface{}, ctx *Context) *RuntimeResult {
 		rr := NewRuntimeResult()
 
 		if len(args) == 2 {
-			if list, ok := args[0].(*List); ok {
+			if iterable, ok := args[0].(Value); ok {
 				if fun, ok := args[1].(Value); ok {
-					newList := []interface{}{}
+					it, err := iterable.Iter()
+					if err != nil {
+						return rr.Failure(err)
+					}
 
-					for index, val := range list.Elements {
-						ctx := NewContext("map")
-						res := rr.Register(fun.Call([]interface{}{val, NewNumber(float64(index))}, ctx))
-						if rr.ShouldReturn() {
-							return rr
+					index := 0
+					mapped := NewIterator("map", func() (Value, bool, *Error) {
+						val, ok, err := it.Next()
+						if err != nil || !ok {
+							return nil, false, err
 						}
-						newList = append(newList, res)
-					}
+						res := CallCallback(fun, []interface{}{val, NewNumber(float64(index))}, ctx)
+						if res.Error != nil {
+							return nil, false, res.Error
+						}
+						index += 1
+						return res.Value, true, nil
+					})
 
-					return rr.Success(NewList(newList))
+					if _, ok := iterable.(*List); ok {
+						return CollectList(mapped)
+					}
+					return rr.Success(mapped)
 				}
 			}
-			return rr.Failure(NewRuntimeError("Expected first argument of map() to be a list and second to be a function", nil, nil))
+			return rr.Failure(NewRuntimeError("Expected first argument of map() to be an iterable and second to be a function", nil, nil))
 		}
 
 		return rr.Failure(NewRuntimeError("Expected 2 arguments to be passed to map()", nil, nil))
@@ -348,19 +382,29 @@ var BuiltinMap = NewBuiltinFunction(
 
 var BuiltinReduce = NewBuiltinFunction(
 	"reduce",
-	[]string{"list, fun, initialValue"},
-	func(args []interface{}) *RuntimeResult {
+	[]string{"iterable", "fun", "initialValue"},
+	func(args []interface{}, ctx *Context) *RuntimeResult {
 		rr := NewRuntimeResult()
 
 		if len(args) == 3 {
-			if list, ok := args[0].(*List); ok {
+			if iterable, ok := args[0].(Value); ok {
 				if fun, ok := args[1].(Value); ok {
 					if initial, ok := args[2].(Value); ok {
-						accum := initial
+						it, err := iterable.Iter()
+						if err != nil {
+							return rr.Failure(err)
+						}
 
-						for index, curr := range list.Elements {
-							ctx := NewContext("reduce")
-							accum = rr.Register(fun.Call([]interface{}{accum, curr, NewNumber(float64(index))}, ctx))
+						accum := initial
+						for index := 0; ; index++ {
+							curr, ok, err := it.Next()
+							if err != nil {
+								return rr.Failure(err)
+							}
+							if !ok {
+								break
+							}
+							accum = rr.Register(CallCallback(fun, []interface{}{accum, curr, NewNumber(float64(index))}, ctx))
 							if rr.ShouldReturn() {
 								return rr
 							}
@@ -370,7 +414,7 @@ var BuiltinReduce = NewBuiltinFunction(
 					}
 				}
 			}
-			return rr.Failure(NewRuntimeError("Expected first argument of reduce() to be a list and second to be a function and third to be a value", nil, nil))
+			return rr.Failure(NewRuntimeError("Expected first argument of reduce() to be an iterable and second to be a function and third to be a value", nil, nil))
 		}
 
 		return rr.Failure(NewRuntimeError("Expected 3 arguments to be passed to reduce()", nil, nil))
@@ -379,30 +423,43 @@ var BuiltinReduce = NewBuiltinFunction(
 
 var BuiltinFilter = NewBuiltinFunction(
 	"filter",
-	[]string{"list, fun"},
-	func(args []interface{}) *RuntimeResult {
+	[]string{"iterable", "fun"},
+	func(args []interface{}, ctx *Context) *RuntimeResult {
 		rr := NewRuntimeResult()
 
 		if len(args) == 2 {
-			if list, ok := args[0].(*List); ok {
+			if iterable, ok := args[0].(Value); ok {
 				if fun, ok := args[1].(Value); ok {
-					newList := []interface{}{}
+					it, err := iterable.Iter()
+					if err != nil {
+						return rr.Failure(err)
+					}
 
-					for index, val := range list.Elements {
-						ctx := NewContext("filter")
-						res := rr.Register(fun.Call([]interface{}{val, NewNumber(float64(index))}, ctx))
-						if rr.ShouldReturn() {
-							return rr
-						}
-						if res.IsTrue() {
-							newList = append(newList, res)
+					index := 0
+					filtered := NewIterator("filter", func() (Value, bool, *Error) {
+						for {
+							val, ok, err := it.Next()
+							if err != nil || !ok {
+								return nil, false, err
+							}
+							res := CallCallback(fun, []interface{}{val, NewNumber(float64(index))}, ctx)
+							if res.Error != nil {
+								return nil, false, res.Error
+							}
+							index += 1
+							if res.Value.IsTrue() {
+								return val, true, nil
+							}
 						}
-					}
+					})
 
-					return rr.Success(NewList(newList))
+					if _, ok := iterable.(*List); ok {
+						return CollectList(filtered)
+					}
+					return rr.Success(filtered)
 				}
 			}
-			return rr.Failure(NewRuntimeError("Expected first argument of filter() to be a list and second to be a function", nil, nil))
+			return rr.Failure(NewRuntimeError("Expected first argument of filter() to be an iterable and second to be a function", nil, nil))
 		}
 
 		return rr.Failure(NewRuntimeError("Expected 2 arguments to be passed to filter()", nil, nil))
@@ -412,7 +469,7 @@ var BuiltinFilter = NewBuiltinFunction(
 var BuiltinMin = NewBuiltinFunction(
 	"min",
 	[]string{"list"},
-	func(args []interface{}) *RuntimeResult {
+	func(args []interface{}, ctx *Context) *RuntimeResult {
 		rr := NewRuntimeResult()
 
 		if len(args) > 0 {
@@ -446,7 +503,7 @@ var BuiltinMin = NewBuiltinFunction(
 var BuiltinMax = NewBuiltinFunction(
 	"max",
 	[]string{"list"},
-	func(args []interface{}) *RuntimeResult {
+	func(args []interface{}, ctx *Context) *RuntimeResult {
 		rr := NewRuntimeResult()
 
 		if len(args) > 0 {
@@ -481,7 +538,7 @@ var BuiltinMax = NewBuiltinFunction(
 var BuiltinTrim = NewBuiltinFunction(
 	"trim",
 	[]string{"string"},
-	func(args []interface{}) *RuntimeResult {
+	func(args []interface{}, ctx *Context) *RuntimeResult {
 		rr := NewRuntimeResult()
 
 		if len(args) > 0 {
@@ -500,7 +557,7 @@ var BuiltinTrim = NewBuiltinFunction(
 var BuiltinUpper = NewBuiltinFunction(
 	"upper",
 	[]string{"string"},
-	func(args []interface{}) *RuntimeResult {
+	func(args []interface{}, ctx *Context) *RuntimeResult {
 		rr := NewRuntimeResult()
 
 		if len(args) > 0 {
@@ -519,7 +576,7 @@ var BuiltinUpper = NewBuiltinFunction(
 var BuiltinLower = NewBuiltinFunction(
 	"lower",
 	[]string{"string"},
-	func(args []interface{}) *RuntimeResult {
+	func(args []interface{}, ctx *Context) *RuntimeResult {
 		rr := NewRuntimeResult()
 
 		if len(args) > 0 {
@@ -537,8 +594,8 @@ var BuiltinLower = NewBuiltinFunction(
 
 var BuiltinReplace = NewBuiltinFunction(
 	"replace",
-	[]string{"string"},
-	func(args []interface{}) *RuntimeResult {
+	[]string{"string", "old", "new"},
+	func(args []interface{}, ctx *Context) *RuntimeResult {
 		rr := NewRuntimeResult()
 
 		if len(args) == 3 {
@@ -561,7 +618,7 @@ var BuiltinReplace = NewBuiltinFunction(
 var BuiltinFloor = NewBuiltinFunction(
 	"floor",
 	[]string{"num"},
-	func(args []interface{}) *RuntimeResult {
+	func(args []interface{}, ctx *Context) *RuntimeResult {
 		rr := NewRuntimeResult()
 
 		if len(args) > 0 {
@@ -577,7 +634,7 @@ var BuiltinFloor = NewBuiltinFunction(
 var BuiltinRound = NewBuiltinFunction(
 	"round",
 	[]string{"num"},
-	func(args []interface{}) *RuntimeResult {
+	func(args []interface{}, ctx *Context) *RuntimeResult {
 		rr := NewRuntimeResult()
 
 		if len(args) > 0 {
@@ -593,7 +650,7 @@ var BuiltinRound = NewBuiltinFunction(
 var BuiltinCeil = NewBuiltinFunction(
 	"ceil",
 	[]string{"num"},
-	func(args []interface{}) *RuntimeResult {
+	func(args []interface{}, ctx *Context) *RuntimeResult {
 		rr := NewRuntimeResult()
 
 		if len(args) > 0 {
@@ -606,11 +663,226 @@ var BuiltinCeil = NewBuiltinFunction(
 	},
 )
 
+// Iterators
+func CollectList(it *Iterator) *RuntimeResult {
+	rr := NewRuntimeResult()
+	elements := []interface{}{}
+
+	for {
+		val, ok, err := it.Next()
+		if err != nil {
+			return rr.Failure(err)
+		}
+		if !ok {
+			break
+		}
+		elements = append(elements, val)
+	}
+
+	return rr.Success(NewList(elements))
+}
+
+var BuiltinRange = NewBuiltinFunction(
+	"range",
+	[]string{"start?", "end", "step?"},
+	func(args []interface{}, ctx *Context) *RuntimeResult {
+		rr := NewRuntimeResult()
+
+		nums := []float64{}
+		for _, arg := range args {
+			num, ok := arg.(*Number)
+			if !ok {
+				return rr.Failure(NewRuntimeError("Expected numbers to be passed to range()", nil, nil))
+			}
+			nums = append(nums, num.Value)
+		}
+
+		start, end, step := 0.0, 0.0, 1.0
+		switch len(nums) {
+		case 1:
+			end = nums[0]
+		case 2:
+			start, end = nums[0], nums[1]
+		case 3:
+			start, end, step = nums[0], nums[1], nums[2]
+		default:
+			return rr.Failure(NewRuntimeError("Expected 1 to 3 arguments to be passed to range()", nil, nil))
+		}
+
+		if step == 0 {
+			return rr.Failure(NewRuntimeError("range() step can't be zero", nil, nil))
+		}
+
+		return rr.Success(NewRange(start, end, step, false))
+	},
+)
+
+var BuiltinZip = NewBuiltinFunction(
+	"zip",
+	[]string{"...iterables"},
+	func(args []interface{}, ctx *Context) *RuntimeResult {
+		rr := NewRuntimeResult()
+
+		its := []*Iterator{}
+		for _, arg := range args {
+			iterable, ok := arg.(Value)
+			if !ok {
+				return rr.Failure(NewRuntimeError("Expected iterables to be passed to zip()", nil, nil))
+			}
+			it, err := iterable.Iter()
+			if err != nil {
+				return rr.Failure(err)
+			}
+			its = append(its, it)
+		}
+
+		return rr.Success(NewIterator("zip", func() (Value, bool, *Error) {
+			if len(its) == 0 {
+				return nil, false, nil
+			}
+			elements := []interface{}{}
+			for _, it := range its {
+				val, ok, err := it.Next()
+				if err != nil || !ok {
+					return nil, false, err
+				}
+				elements = append(elements, val)
+			}
+			return NewList(elements), true, nil
+		}))
+	},
+)
+
+var BuiltinEnumerate = NewBuiltinFunction(
+	"enumerate",
+	[]string{"iterable", "start?"},
+	func(args []interface{}, ctx *Context) *RuntimeResult {
+		rr := NewRuntimeResult()
+
+		if len(args) == 0 || len(args) > 2 {
+			return rr.Failure(NewRuntimeError("Expected 1 or 2 arguments to be passed to enumerate()", nil, nil))
+		}
+
+		iterable, ok := args[0].(Value)
+		if !ok {
+			return rr.Failure(NewRuntimeError("Expected an iterable to be passed to enumerate()", nil, nil))
+		}
+		it, err := iterable.Iter()
+		if err != nil {
+			return rr.Failure(err)
+		}
+
+		index := 0.0
+		if len(args) == 2 {
+			start, ok := args[1].(*Number)
+			if !ok {
+				return rr.Failure(NewRuntimeError("Expected the start of enumerate() to be a number", nil, nil))
+			}
+			index = start.Value
+		}
+
+		return rr.Success(NewIterator("enumerate", func() (Value, bool, *Error) {
+			val, ok, err := it.Next()
+			if err != nil || !ok {
+				return nil, false, err
+			}
+			index += 1
+			return NewList([]interface{}{NewNumber(index - 1), val}), true, nil
+		}))
+	},
+)
+
+var BuiltinTake = NewBuiltinFunction(
+	"take",
+	[]string{"iterable", "n"},
+	func(args []interface{}, ctx *Context) *RuntimeResult {
+		rr := NewRuntimeResult()
+
+		if len(args) == 2 {
+			if iterable, ok := args[0].(Value); ok {
+				if n, ok := args[1].(*Number); ok {
+					it, err := iterable.Iter()
+					if err != nil {
+						return rr.Failure(err)
+					}
+
+					taken := 0
+					return rr.Success(NewIterator("take", func() (Value, bool, *Error) {
+						if float64(taken) >= n.Value {
+							return nil, false, nil
+						}
+						taken += 1
+						return it.Next()
+					}))
+				}
+			}
+			return rr.Failure(NewRuntimeError("Expected first argument of take() to be an iterable and second to be a number", nil, nil))
+		}
+
+		return rr.Failure(NewRuntimeError("Expected 2 arguments to be passed to take()", nil, nil))
+	},
+)
+
+var BuiltinChain = NewBuiltinFunction(
+	"chain",
+	[]string{"...iterables"},
+	func(args []interface{}, ctx *Context) *RuntimeResult {
+		rr := NewRuntimeResult()
+
+		its := []*Iterator{}
+		for _, arg := range args {
+			iterable, ok := arg.(Value)
+			if !ok {
+				return rr.Failure(NewRuntimeError("Expected iterables to be passed to chain()", nil, nil))
+			}
+			it, err := iterable.Iter()
+			if err != nil {
+				return rr.Failure(err)
+			}
+			its = append(its, it)
+		}
+
+		return rr.Success(NewIterator("chain", func() (Value, bool, *Error) {
+			for len(its) > 0 {
+				val, ok, err := its[0].Next()
+				if err != nil {
+					return nil, false, err
+				}
+				if ok {
+					return val, true, nil
+				}
+				its = its[1:]
+			}
+			return nil, false, nil
+		}))
+	},
+)
+
+var BuiltinList = NewBuiltinFunction(
+	"list",
+	[]string{"iterable"},
+	func(args []interface{}, ctx *Context) *RuntimeResult {
+		rr := NewRuntimeResult()
+
+		if len(args) == 1 {
+			if iterable, ok := args[0].(Value); ok {
+				it, err := iterable.Iter()
+				if err != nil {
+					return rr.Failure(err)
+				}
+				return CollectList(it)
+			}
+		}
+
+		return rr.Failure(NewRuntimeError("Expected one iterable to be passed to list()", nil, nil))
+	},
+)
+
 // Conversion
 var BuiltinNum = NewBuiltinFunction(
 	"num",
 	[]string{"value"},
-	func(args []interface{}) *RuntimeResult {
+	func(args []interface{}, ctx *Context) *RuntimeResult {
 		rr := NewRuntimeResult()
 
 		if len(args) > 0 {
@@ -630,7 +902,7 @@ var BuiltinNum = NewBuiltinFunction(
 var BuiltinStr = NewBuiltinFunction(
 	"str",
 	[]string{"value"},
-	func(args []interface{}) *RuntimeResult {
+	func(args []interface{}, ctx *Context) *RuntimeResult {
 		rr := NewRuntimeResult()
 
 		if len(args) > 0 {
@@ -643,3 +915,158 @@ var BuiltinStr = NewBuiltinFunction(
 		return rr.Failure(NewRuntimeError("Expected one argument to be passed to str()", nil, nil))
 	},
 )
+
+// Types
+var BuiltinType = NewBuiltinFunction(
+	"type",
+	[]string{"value"},
+	func(args []interface{}, ctx *Context) *RuntimeResult {
+		rr := NewRuntimeResult()
+
+		if len(args) == 1 {
+			if val, ok := args[0].(Value); ok {
+				return rr.Success(NewString(TypeName(val)))
+			}
+		}
+
+		return rr.Failure(NewRuntimeError("Expected one argument to be passed to type()", nil, nil))
+	},
+)
+
+// NewTypePredicate makes a builtin like is_num() which checks if its argument
+// is of the type t
+func NewTypePredicate(t string) Value {
+	name := "is_" + t
+	return NewBuiltinFunction(
+		name,
+		[]string{"value"},
+		func(args []interface{}, ctx *Context) *RuntimeResult {
+			rr := NewRuntimeResult()
+
+			if len(args) == 1 {
+				if val, ok := args[0].(Value); ok && TypeName(val) == t {
+					return rr.Success(NewNumber(1))
+				}
+				return rr.Success(NewNumber(0))
+			}
+
+			return rr.Failure(NewRuntimeError(fmt.Sprintf("Expected one argument to be passed to %v()", name), nil, nil))
+		},
+	)
+}
+
+var BuiltinIsNum = NewTypePredicate("num")
+var BuiltinIsStr = NewTypePredicate("str")
+var BuiltinIsList = NewTypePredicate("list")
+var BuiltinIsMap = NewTypePredicate("map")
+var BuiltinIsFun = NewTypePredicate("fun")
+var BuiltinIsNull = NewTypePredicate("null")
+
+// Testing
+
+// assertMessage returns the message passed as the optional last argument of
+// an assertion, or msg when there's none
+func assertMessage(args []interface{}, at int, msg string) string {
+	if len(args) > at {
+		if str, ok := args[at].(*String); ok {
+			return str.GetVal().(string)
+		}
+		return fmt.Sprint(args[at])
+	}
+	return msg
+}
+
+// assertLines splits a value into lines for diffing, strings by their lines
+// and lists and maps by their elements
+func assertLines(val Value) string {
+	text := ""
+	switch v := val.(type) {
+	case *String:
+		return v.GetVal().(string) + "\n"
+	case *List:
+		for _, el := range v.Elements {
+			text += Repr(el.(Value)) + "\n"
+		}
+	case *Map:
+		for _, key := range v.Keys {
+			text += key + ": " + Repr(v.Values[key]) + "\n"
+		}
+	default:
+		text = Repr(val) + "\n"
+	}
+	return text
+}
+
+var BuiltinAssert = NewBuiltinFunction(
+	"assert",
+	[]string{"condition", "message?"},
+	func(args []interface{}, ctx *Context) *RuntimeResult {
+		rr := NewRuntimeResult()
+
+		if len(args) < 1 {
+			return rr.Failure(NewRuntimeError("Expected a condition to be passed to assert()", nil, nil))
+		}
+		if cond, ok := args[0].(Value); ok && cond.IsTrue() {
+			return rr.Success(NewNull())
+		}
+
+		return rr.Failure(NewAssertionError(assertMessage(args, 1, "The condition is false"), nil, nil))
+	},
+)
+
+var BuiltinAssertEq = NewBuiltinFunction(
+	"assert_eq",
+	[]string{"actual", "expected", "message?"},
+	func(args []interface{}, ctx *Context) *RuntimeResult {
+		rr := NewRuntimeResult()
+
+		if len(args) < 2 {
+			return rr.Failure(NewRuntimeError("Expected 2 arguments to be passed to assert_eq()", nil, nil))
+		}
+		actual, expected := args[0].(Value), args[1].(Value)
+		if ValuesEqual(actual, expected) {
+			return rr.Success(NewNull())
+		}
+
+		msg := fmt.Sprintf("Expected %v, got %v", Repr(expected), Repr(actual))
+		if len(args) > 2 {
+			msg = assertMessage(args, 2, "") + ": " + msg
+		}
+		// Values that take more than a line are easier to compare as a diff
+		expectedText, actualText := assertLines(expected), assertLines(actual)
+		if TypeName(actual) == TypeName(expected) && strings.Count(expectedText + actualText, "\n") > 2 {
+			msg += "\n" + strings.TrimSuffix(UnifiedDiff(expectedText, actualText, "expected", "actual"), "\n")
+		}
+		return rr.Failure(NewAssertionError(msg, nil, nil))
+	},
+)
+
+var BuiltinAssertRaises = NewBuiltinFunction(
+	"assert_raises",
+	[]string{"fun", "message?"},
+	func(args []interface{}, ctx *Context) *RuntimeResult {
+		rr := NewRuntimeResult()
+
+		if len(args) < 1 {
+			return rr.Failure(NewRuntimeError("Expected a function to be passed to assert_raises()", nil, nil))
+		}
+		fun, ok := args[0].(Value)
+		if _, isFun := fun.(*Function); !ok || !isFun {
+			if _, isBuiltin := fun.(*BuiltinFunction); !isBuiltin {
+				return rr.Failure(NewRuntimeError("assert_raises() expects a function", nil, nil))
+			}
+		}
+
+		// The error is what the test expects, so it's returned to be checked
+		res := fun.Call([]interface{}{}, ctx)
+		if res.Error != nil {
+			return rr.Success(NewString(res.Error.Details))
+		}
+
+		return rr.Failure(NewAssertionError(assertMessage(args, 1, "Expected the function to raise an error"), nil, nil))
+	},
+)
+
+func (f *BuiltinFunction) Iter() (*Iterator, *Error) {
+	return nil, NewRuntimeError("Can't iterate over a function", f.StartPos, f.EndPos)
+}
@@ -0,0 +1,481 @@
+package main
+
+import "fmt"
+
+type CheckerSymbol struct {
+	Type *TypeNode
+	Fun *FunDefNode
+	Declared bool
+}
+
+// Checker walks the AST without running it and reports values that don't
+// fit the type annotations, a type that can't be known is never an error
+type Checker struct {
+	Scopes []map[string]*CheckerSymbol
+	ReturnTypes []*TypeNode
+	Errors []*Error
+}
+
+func NewChecker() *Checker {
+	c := &Checker{
+		Scopes: []map[string]*CheckerSymbol{{}},
+	}
+	return c
+}
+
+var numType = NewTypeNode("num", nil, nil, nil)
+
+func (c *Checker) Lookup(name string) *CheckerSymbol {
+	for i := len(c.Scopes) - 1; i >= 0; i-- {
+		if sym, ok := c.Scopes[i][name]; ok {
+			return sym
+		}
+	}
+	return nil
+}
+
+// Define binds a name in the current scope, names declared using `let` keep
+// their annotated type
+func (c *Checker) Define(name string, sym *CheckerSymbol) {
+	scope := c.Scopes[len(c.Scopes) - 1]
+	if old, ok := scope[name]; ok && old.Declared && !sym.Declared {
+		return
+	}
+	scope[name] = sym
+}
+
+func (c *Checker) Report(details string, node interface{}) {
+	sp, ep := NodePosition(node)
+	c.Errors = append(c.Errors, NewTypeError(details, sp, ep))
+}
+
+// Expect reports a node whose type is known and doesn't fit the type t, the
+// elements of list and map literals are checked one by one
+func (c *Checker) Expect(what string, node interface{}, t *TypeNode) {
+	if t != nil && len(t.Args) > 0 {
+		switch n := node.(type) {
+		case *ListNode:
+			if t.Name == "list" {
+				for _, el := range n.Elements {
+					c.Expect("an element of "+what, el, t.Args[0])
+				}
+				return
+			}
+		case *MapNode:
+			if t.Name == "map" {
+				for _, val := range n.Values {
+					c.Expect("a value of "+what, val, t.Args[0])
+				}
+				return
+			}
+		}
+	}
+	got := c.Check(node)
+	if !IsAssignable(got, t) {
+		c.Report(fmt.Sprintf("Expected %v to be %v, got %v", what, t, got), node)
+	}
+}
+
+// IsAssignable reports whether a value of type from fits the type to, unknown
+// types fit anything
+func IsAssignable(from, to *TypeNode) bool {
+	if from == nil || to == nil || from.Name == "any" || to.Name == "any" {
+		return true
+	}
+	if from.Name == "null" {
+		return to.Nullable || to.Name == "null"
+	}
+	if from.Nullable && !to.Nullable {
+		return false
+	}
+	if from.Name != to.Name {
+		return false
+	}
+	if len(from.Args) == 0 || len(to.Args) == 0 {
+		return true
+	}
+	return IsAssignable(from.Args[0], to.Args[0])
+}
+
+// commonType returns the type shared by all the types, or nil if they differ
+func commonType(types []*TypeNode) *TypeNode {
+	if len(types) == 0 || types[0] == nil {
+		return nil
+	}
+	for _, t := range types[1:] {
+		if t == nil || t.String() != types[0].String() {
+			return nil
+		}
+	}
+	return types[0]
+}
+
+func (c *Checker) CheckPattern(pattern interface{}) {
+	for _, name := range PatternNames(pattern) {
+		c.Define(name, &CheckerSymbol{})
+	}
+}
+
+// Branches checks code that only runs some of the time, like the cases of an
+// if or the body of a loop, each branch starts from the types before them and
+// a name that a branch gives another type has an unknown type after them
+func (c *Checker) Branches(nodes ...interface{}) {
+	top := len(c.Scopes) - 1
+	before := c.Scopes[top]
+	merged := map[string]*CheckerSymbol{}
+	for name, sym := range before {
+		merged[name] = sym
+	}
+	for _, node := range nodes {
+		c.Scopes[top] = map[string]*CheckerSymbol{}
+		for name, sym := range before {
+			c.Scopes[top][name] = sym
+		}
+		c.Check(node)
+		for name, sym := range c.Scopes[top] {
+			old, ok := merged[name]
+			if !ok {
+				merged[name] = sym
+			} else if old != sym && commonType([]*TypeNode{old.Type, sym.Type}) == nil {
+				merged[name] = &CheckerSymbol{}
+			}
+		}
+	}
+	c.Scopes[top] = merged
+}
+
+func (c *Checker) CheckAll(nodes []interface{}) []*TypeNode {
+	types := []*TypeNode{}
+	for _, node := range nodes {
+		types = append(types, c.Check(node))
+	}
+	return types
+}
+
+// Check checks a node and its children and returns the type of its value
+func (c *Checker) Check(node interface{}) *TypeNode {
+	switch n := node.(type) {
+	case *NumberNode:
+		return numType
+	case *StringNode:
+		return NewTypeNode("str", nil, nil, nil)
+	case *NullNode:
+		return NewTypeNode("null", nil, nil, nil)
+	case *ListNode:
+		types := c.CheckAll(n.Elements)
+		if el := commonType(types); el != nil {
+			return NewTypeNode("list", []*TypeNode{el}, nil, nil)
+		}
+		return NewTypeNode("list", nil, nil, nil)
+	case *MapNode:
+		types := c.CheckAll(n.Values)
+		if val := commonType(types); val != nil {
+			return NewTypeNode("map", []*TypeNode{val}, nil, nil)
+		}
+		return NewTypeNode("map", nil, nil, nil)
+	case *VarAccessNode:
+		name := n.NameToken.Value.(string)
+		if name == "true" || name == "false" {
+			return numType
+		}
+		if sym := c.Lookup(name); sym != nil {
+			return sym.Type
+		}
+		return nil
+	case *LetNode:
+		name := n.NameToken.Value.(string)
+		c.Expect(fmt.Sprintf("'%v'", name), n.Value, n.Type)
+		c.Define(name, &CheckerSymbol{Type: n.Type, Declared: n.Type != nil})
+		return n.Type
+	case *VarAssignNode:
+		name := n.NameToken.Value.(string)
+		scope := c.Scopes[len(c.Scopes) - 1]
+		if sym, ok := scope[name]; ok && sym.Declared {
+			c.Expect(fmt.Sprintf("'%v'", name), n.ValueNode, sym.Type)
+			return sym.Type
+		}
+		t := c.Check(n.ValueNode)
+		sym := &CheckerSymbol{Type: t}
+		if fun, ok := n.ValueNode.(*FunDefNode); ok {
+			sym.Fun = fun
+		}
+		c.Define(name, sym)
+		return t
+	case *CompoundAssignNode:
+		c.Check(n.Target)
+		c.Check(n.Value)
+	case *DestructureAssignNode:
+		c.Check(n.Value)
+		c.CheckPattern(n.Pattern)
+	case *BinOpNode:
+		return c.CheckBinOp(n)
+	case *IsNode:
+		c.Check(n.Node)
+		return numType
+	case *UnaryOpNode:
+		c.Check(n.Node)
+		return numType
+	case *TernOpNode:
+		c.Check(n.Cond)
+		return commonType(c.CheckAll([]interface{}{n.Left, n.Right}))
+	case *IfNode:
+		bodies := []interface{}{n.ElseCase}
+		for _, cs := range n.Cases {
+			c.Check(cs[0])
+			bodies = append(bodies, cs[1])
+		}
+		c.Branches(bodies...)
+	case *WhileNode:
+		c.Check(n.Cond)
+		c.Branches(n.Exp)
+		c.Branches(n.ElseCase)
+	case *WhileLetNode:
+		c.Check(n.Value)
+		c.CheckPattern(n.Pattern)
+		c.Branches(n.Body)
+		c.Branches(n.ElseCase)
+	case *LoopNode:
+		c.Check(n.Body)
+	case *DoWhileNode:
+		c.Check(n.Body)
+		c.Check(n.Cond)
+	case *ForNode:
+		c.Expect("the start of the loop", n.From, numType)
+		c.Expect("the end of the loop", n.To, numType)
+		if n.By != nil {
+			c.Expect("the step of the loop", n.By, numType)
+		}
+		c.Define(n.Var.Value.(string), &CheckerSymbol{Type: numType})
+		c.Branches(n.Body)
+		c.Branches(n.ElseCase)
+	case *EachNode:
+		c.Check(n.List)
+		if n.IndexName != nil {
+			c.Define(n.IndexName.Value.(string), &CheckerSymbol{})
+		}
+		if n.ItemName != nil {
+			c.Define(n.ItemName.Value.(string), &CheckerSymbol{})
+		}
+		c.CheckPattern(n.ItemPattern)
+		c.Branches(n.Body)
+		c.Branches(n.ElseCase)
+	case *ComprehensionNode:
+		for _, clause := range n.Clauses {
+			if each, ok := clause.(*EachClauseNode); ok {
+				c.Check(each.List)
+				if each.IndexName != nil {
+					c.Define(each.IndexName.Value.(string), &CheckerSymbol{})
+				}
+				c.CheckPattern(each.ItemPattern)
+			} else {
+				c.Check(clause)
+			}
+		}
+		c.Check(n.Key)
+		c.Check(n.Value)
+		if n.Key != nil {
+			return NewTypeNode("map", nil, nil, nil)
+		}
+		return NewTypeNode("list", nil, nil, nil)
+	case *FunDefNode:
+		return c.CheckFunDef(n)
+	case *FunCallNode:
+		return c.CheckFunCall(n)
+	case *SpreadNode:
+		c.Check(n.Node)
+	case *KeywordArgNode:
+		return c.Check(n.Value)
+	case *ReturnNode:
+		if len(c.ReturnTypes) == 0 {
+			c.Check(n.Value)
+			return nil
+		}
+		t := c.ReturnTypes[len(c.ReturnTypes) - 1]
+		if n.Value == nil {
+			return nil
+		}
+		c.Expect("the return value", n.Value, t)
+	case *YieldNode:
+		c.Check(n.Value)
+	case *ElementAccessNode:
+		c.Check(n.Node)
+		c.Check(n.Index)
+		c.Check(n.To)
+	case *ElementAssignNode:
+		c.Check(n.Node)
+		c.Check(n.Index)
+		c.Check(n.Value)
+	case *MatchNode:
+		c.Check(n.Value)
+		bodies := []interface{}{}
+		for _, cs := range n.Cases {
+			c.CheckPattern(cs.Pattern)
+			c.Check(cs.Guard)
+			bodies = append(bodies, cs.Body)
+		}
+		c.Branches(bodies...)
+	}
+	return nil
+}
+
+func (c *Checker) CheckBinOp(b *BinOpNode) *TypeNode {
+	left := c.Check(b.Left)
+	right := c.Check(b.Right)
+	op := b.Op.Value
+
+	if b.Op.Type == TTKeyword {
+		if op == "and" || op == "or" {
+			return commonType([]*TypeNode{left, right})
+		}
+		return nil
+	}
+
+	switch op {
+	case "==", "!=", "<", "<=", ">", ">=":
+		return numType
+	case "..", "..<":
+		return NewTypeNode("range", nil, nil, nil)
+	case "??":
+		return right
+	case "+":
+		if left != nil && left.Name == "str" || right != nil && right.Name == "str" {
+			return NewTypeNode("str", nil, nil, nil)
+		}
+		fallthrough
+	case "-", "*", "/", "%", "^":
+		if left != nil && right != nil && left.Name == "num" && right.Name == "num" {
+			return numType
+		}
+	}
+	return nil
+}
+
+func (c *Checker) CheckFunDef(f *FunDefNode) *TypeNode {
+	if f.Name != "" {
+		c.Define(f.Name, &CheckerSymbol{Type: NewTypeNode("fun", nil, nil, nil), Fun: f})
+	}
+
+	scope := map[string]*CheckerSymbol{}
+	for _, param := range f.Params {
+		if param.Default != nil {
+			c.Expect(fmt.Sprintf("the default of '%v'", param.Name), param.Default, param.Type)
+		}
+		if param.Pattern != nil {
+			for _, name := range PatternNames(param.Pattern) {
+				scope[name] = &CheckerSymbol{}
+			}
+			continue
+		}
+		scope[param.Name] = &CheckerSymbol{Type: param.Type, Declared: param.Type != nil}
+	}
+
+	c.Scopes = append(c.Scopes, scope)
+	if f.IsGenerator {
+		c.ReturnTypes = append(c.ReturnTypes, nil)
+	} else {
+		c.ReturnTypes = append(c.ReturnTypes, f.ReturnType)
+	}
+
+	if f.ReturnBody && !f.IsGenerator {
+		c.Expect("the return value", f.Body, f.ReturnType)
+	} else {
+		c.Check(f.Body)
+	}
+
+	c.Scopes = c.Scopes[:len(c.Scopes) - 1]
+	c.ReturnTypes = c.ReturnTypes[:len(c.ReturnTypes) - 1]
+
+	return NewTypeNode("fun", nil, nil, nil)
+}
+
+func (c *Checker) CheckFunCall(call *FunCallNode) *TypeNode {
+	c.Check(call.Name)
+
+	var fun *FunDefNode
+	if access, ok := call.Name.(*VarAccessNode); ok {
+		if sym := c.Lookup(access.NameToken.Value.(string)); sym != nil {
+			fun = sym.Fun
+		}
+	}
+	if fun == nil {
+		c.CheckAll(call.Args)
+		return nil
+	}
+
+	// A function value is only used to name the function and its arity the
+	// same way runtime errors do
+	f := NewFunction(fun.Name, fun.Params, fun.Body, fun.ReturnBody, fun.IsGenerator).(*Function)
+
+	hasSpread := false
+	positional := 0
+	given := map[string]bool{}
+	for _, arg := range call.Args {
+		switch a := arg.(type) {
+		case *SpreadNode:
+			hasSpread = true
+			c.Check(a)
+		case *KeywordArgNode:
+			name := a.NameToken.Value.(string)
+			var param *ParamNode
+			for _, p := range fun.Params {
+				if p.Name == name && !p.Variadic {
+					param = p
+				}
+			}
+			if param == nil {
+				c.Report(fmt.Sprintf("%v got an unexpected keyword argument '%v'", f, name), a)
+				c.Check(a.Value)
+				continue
+			}
+			given[name] = true
+			c.Expect(fmt.Sprintf("the argument '%v' of %v", name, f), a.Value, param.Type)
+		default:
+			if hasSpread {
+				c.Check(arg)
+				continue
+			}
+			if positional >= len(fun.Params) {
+				c.Report(fmt.Sprintf("%v expected %v, got %v", f, f.Arity(), positionalCount(call.Args)), arg)
+				c.Check(arg)
+				continue
+			}
+			param := fun.Params[positional]
+			what := fmt.Sprintf("the argument '%v' of %v", param.Name, f)
+			if param.Variadic {
+				var t *TypeNode
+				if param.Type != nil && param.Type.Name == "list" && len(param.Type.Args) > 0 {
+					t = param.Type.Args[0]
+				}
+				c.Expect("an element of "+what, arg, t)
+				continue
+			}
+			given[param.Name] = true
+			positional++
+			c.Expect(what, arg, param.Type)
+		}
+	}
+
+	if !hasSpread {
+		for _, param := range fun.Params {
+			if !param.Variadic && param.Default == nil && !given[param.Name] {
+				c.Report(fmt.Sprintf("%v expected %v, got %v", f, f.Arity(), positionalCount(call.Args)), call)
+				break
+			}
+		}
+	}
+
+	if fun.IsGenerator {
+		return NewTypeNode("iterator", nil, nil, nil)
+	}
+	return fun.ReturnType
+}
+
+func positionalCount(args []interface{}) int {
+	count := 0
+	for _, arg := range args {
+		if _, ok := arg.(*KeywordArgNode); !ok {
+			count++
+		}
+	}
+	return count
+}
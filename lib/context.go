@@ -4,6 +4,10 @@ type Context struct {
 	Name string
 	SymbolTable *SymbolTable
 	Parent *Context
+	Yield func(Value)
+	// Pos is where the statement running in the context starts, it's only
+	// kept while a debugger is attached
+	Pos *Position
 }
 
 func NewContext(n string) *Context {
@@ -0,0 +1,272 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+// ActiveCoverage counts how many times the statements of the loaded files
+// run while a program runs with `--coverage`
+var ActiveCoverage *Coverage
+
+type coverageStatement struct {
+	Line int
+	Count int
+}
+
+type coverageFunction struct {
+	Name string
+	Line int
+	// First is the first statement of the body, it runs once per call
+	First *coverageStatement
+}
+
+type coverageFile struct {
+	Name string
+	Text string
+	Statements []*coverageStatement
+	Functions []*coverageFunction
+}
+
+// Lines returns the hits of every line a statement starts on, a line is
+// covered when any of its statements ran
+func (f *coverageFile) Lines() map[int]int {
+	lines := map[int]int{}
+	for _, stmt := range f.Statements {
+		if count, ok := lines[stmt.Line]; !ok || stmt.Count > count {
+			lines[stmt.Line] = stmt.Count
+		}
+	}
+	return lines
+}
+
+type Coverage struct {
+	// Out is where the report is written when the program ends, as HTML when
+	// it ends with .html and as LCOV otherwise
+	Out string
+	Files []*coverageFile
+	statements map[interface{}]*coverageStatement
+}
+
+func NewCoverage(out string) *Coverage {
+	c := &Coverage{
+		Out: out,
+		statements: map[interface{}]*coverageStatement{},
+	}
+	return c
+}
+
+// Add registers the statements of a parsed file, the source shown in the
+// reports comes from their positions
+func (c *Coverage) Add(name string, ast interface{}) {
+	file := &coverageFile{Name: name}
+	firsts := map[*coverageFunction]interface{}{}
+	for _, node := range StatementNodes(ast) {
+		sp, _ := FirstPosition(node)
+		file.Text = sp.FileText
+		stmt := &coverageStatement{Line: sp.Line}
+		c.statements[node] = stmt
+		file.Statements = append(file.Statements, stmt)
+
+		if def, ok := node.(*FunDefNode); ok && def.Name != "" {
+			fun := &coverageFunction{Name: def.Name, Line: sp.Line}
+			file.Functions = append(file.Functions, fun)
+			if body := StatementNodes(def.Body); len(body) > 0 {
+				firsts[fun] = body[0]
+			}
+		}
+	}
+	for fun, first := range firsts {
+		fun.First = c.statements[first]
+	}
+	c.Files = append(c.Files, file)
+}
+
+// Hit counts a run of a node if it's a statement
+func (c *Coverage) Hit(node interface{}) {
+	if stmt, ok := c.statements[node]; ok {
+		stmt.Count++
+	}
+}
+
+// StartCoverage starts counting the statements of the programs that run
+func StartCoverage(out string) {
+	ActiveCoverage = NewCoverage(out)
+}
+
+// StopCoverage stops counting and reports the coverage, it's called when the
+// program ends or exits
+func StopCoverage() {
+	c := ActiveCoverage
+	if c == nil {
+		return
+	}
+	ActiveCoverage = nil
+
+	c.WriteSummary(os.Stderr)
+	if c.Out == "" {
+		return
+	}
+	file, err := os.Create(c.Out)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Failed to write the coverage to", c.Out)
+		return
+	}
+	defer file.Close()
+	if strings.HasSuffix(c.Out, ".html") {
+		c.WriteHTML(file)
+	} else {
+		c.WriteLCOV(file)
+	}
+}
+
+func coveragePercent(covered, total int) float64 {
+	if total == 0 {
+		return 100
+	}
+	return float64(covered) * 100 / float64(total)
+}
+
+// lineRanges writes sorted line numbers as ranges like 3, 7-9
+func lineRanges(lines []int) string {
+	ranges := []string{}
+	for i := 0; i < len(lines); {
+		j := i
+		for j + 1 < len(lines) && lines[j + 1] == lines[j] + 1 {
+			j++
+		}
+		if i == j {
+			ranges = append(ranges, fmt.Sprint(lines[i]))
+		} else {
+			ranges = append(ranges, fmt.Sprintf("%v-%v", lines[i], lines[j]))
+		}
+		i = j + 1
+	}
+	return strings.Join(ranges, ", ")
+}
+
+// WriteSummary prints how many statements of every file ran and the lines
+// that never did
+func (c *Coverage) WriteSummary(out io.Writer) {
+	fmt.Fprintln(out, "\nCoverage:")
+	covered, total := 0, 0
+	for _, file := range c.Files {
+		fileCovered := 0
+		for _, stmt := range file.Statements {
+			if stmt.Count > 0 {
+				fileCovered++
+			}
+		}
+		covered += fileCovered
+		total += len(file.Statements)
+
+		missed := []int{}
+		for line, count := range file.Lines() {
+			if count == 0 {
+				missed = append(missed, line)
+			}
+		}
+		sort.Ints(missed)
+
+		fmt.Fprintf(out, "%6.1f%%  %v/%v statements  %v", coveragePercent(fileCovered, len(file.Statements)),
+			fileCovered, len(file.Statements), file.Name)
+		if len(missed) > 0 {
+			fmt.Fprintf(out, "  (missed lines %v)", lineRanges(missed))
+		}
+		fmt.Fprintln(out)
+	}
+	if len(c.Files) > 1 {
+		fmt.Fprintf(out, "%6.1f%%  %v/%v statements  total\n", coveragePercent(covered, total), covered, total)
+	}
+}
+
+// WriteLCOV writes the line and function coverage in the LCOV format that CI
+// tools read
+func (c *Coverage) WriteLCOV(out io.Writer) {
+	for _, file := range c.Files {
+		fmt.Fprintln(out, "TN:")
+		fmt.Fprintf(out, "SF:%v\n", file.Name)
+
+		hit := 0
+		for _, fun := range file.Functions {
+			fmt.Fprintf(out, "FN:%v,%v\n", fun.Line, fun.Name)
+		}
+		for _, fun := range file.Functions {
+			count := 0
+			if fun.First != nil {
+				count = fun.First.Count
+			}
+			if count > 0 {
+				hit++
+			}
+			fmt.Fprintf(out, "FNDA:%v,%v\n", count, fun.Name)
+		}
+		fmt.Fprintf(out, "FNF:%v\nFNH:%v\n", len(file.Functions), hit)
+
+		lines := file.Lines()
+		numbers := []int{}
+		for line := range lines {
+			numbers = append(numbers, line)
+		}
+		sort.Ints(numbers)
+		hit = 0
+		for _, line := range numbers {
+			if lines[line] > 0 {
+				hit++
+			}
+			fmt.Fprintf(out, "DA:%v,%v\n", line, lines[line])
+		}
+		fmt.Fprintf(out, "LF:%v\nLH:%v\n", len(numbers), hit)
+		fmt.Fprintln(out, "end_of_record")
+	}
+}
+
+const coverageStyle = `body { font-family: sans-serif; margin: 2em; }
+table.summary td, table.summary th { padding: 0.2em 1em; text-align: left; }
+pre { font-family: monospace; margin: 0; }
+table.source { border-collapse: collapse; width: 100%; margin-bottom: 2em; }
+table.source td { padding: 0 0.5em; vertical-align: top; }
+td.line, td.count { color: #888; text-align: right; user-select: none; width: 1%; white-space: nowrap; }
+tr.covered td.code { background: #dfd; }
+tr.missed td.code { background: #fdd; }`
+
+// WriteHTML writes a page with the source of every file, where the lines
+// that ran are green and the ones that never did are red
+func (c *Coverage) WriteHTML(out io.Writer) {
+	fmt.Fprintf(out, "<!DOCTYPE html>\n<html>\n<head>\n<meta charset=\"utf-8\">\n<title>Coverage</title>\n<style>\n%v\n</style>\n</head>\n<body>\n", coverageStyle)
+
+	fmt.Fprintln(out, "<h1>Coverage</h1>\n<table class=\"summary\">\n<tr><th>File</th><th>Lines</th><th>Covered</th></tr>")
+	for i, file := range c.Files {
+		lines, covered := file.Lines(), 0
+		for _, count := range lines {
+			if count > 0 {
+				covered++
+			}
+		}
+		fmt.Fprintf(out, "<tr><td><a href=\"#file%v\">%v</a></td><td>%v/%v</td><td>%.1f%%</td></tr>\n",
+			i, html.EscapeString(file.Name), covered, len(lines), coveragePercent(covered, len(lines)))
+	}
+	fmt.Fprintln(out, "</table>")
+
+	for i, file := range c.Files {
+		fmt.Fprintf(out, "<h2 id=\"file%v\">%v</h2>\n<table class=\"source\">\n", i, html.EscapeString(file.Name))
+		lines := file.Lines()
+		for n, text := range strings.Split(strings.TrimSuffix(file.Text, "\n"), "\n") {
+			class, count := "", ""
+			if hits, ok := lines[n + 1]; ok {
+				class, count = "missed", "0"
+				if hits > 0 {
+					class, count = "covered", fmt.Sprint(hits)
+				}
+			}
+			fmt.Fprintf(out, "<tr class=\"%v\"><td class=\"line\">%v</td><td class=\"count\">%v</td><td class=\"code\"><pre>%v</pre></td></tr>\n",
+				class, n + 1, count, html.EscapeString(text))
+		}
+		fmt.Fprintln(out, "</table>")
+	}
+	fmt.Fprintln(out, "</body>\n</html>")
+}
@@ -0,0 +1,556 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// The debugger speaks the Debug Adapter Protocol over stdio. The program runs
+// on its own goroutine and DebugHook pauses it at statements, while it's
+// paused the adapter answers questions about its frames and variables
+
+type debugMode int
+
+const (
+	debugContinue debugMode = iota
+	debugStepIn
+	debugStepOver
+	debugStepOut
+)
+
+type debugBreakpoint struct {
+	Line int
+	Condition interface{}
+}
+
+// debugFrame is a context on the call stack of the paused program
+type debugFrame struct {
+	Ctx *Context
+	Pos *Position
+}
+
+type dapRequest struct {
+	Seq int `json:"seq"`
+	Command string `json:"command"`
+	Arguments json.RawMessage `json:"arguments"`
+}
+
+type Debugger struct {
+	Program string
+	Source string
+	AST interface{}
+	// Statements are the nodes the program can pause at, FirstOnLine is the
+	// first of them on each line which is where breakpoints stop
+	Statements map[interface{}]bool
+	FirstOnLine map[int]interface{}
+	Breakpoints map[int]*debugBreakpoint
+	StopOnEntry bool
+
+	mu sync.Mutex
+	out io.Writer
+	outMu sync.Mutex
+	seq int
+	mode debugMode
+	depth int
+	pause bool
+	evaluating bool
+	frames []*debugFrame
+	handles []interface{}
+	resume chan debugMode
+	started bool
+}
+
+func NewDebugger(out io.Writer) *Debugger {
+	d := &Debugger{
+		Statements: map[interface{}]bool{},
+		FirstOnLine: map[int]interface{}{},
+		Breakpoints: map[int]*debugBreakpoint{},
+		out: out,
+		resume: make(chan debugMode),
+	}
+	return d
+}
+
+func (d *Debugger) addStatement(node interface{}) {
+	sp, _ := FirstPosition(node)
+	if sp == nil {
+		return
+	}
+	d.Statements[node] = true
+	if first, ok := d.FirstOnLine[sp.Line]; ok {
+		if firstPos, _ := FirstPosition(first); firstPos.Index <= sp.Index {
+			return
+		}
+	}
+	d.FirstOnLine[sp.Line] = node
+}
+
+func contextDepth(ctx *Context) int {
+	depth := 0
+	for ; ctx != nil; ctx = ctx.Parent {
+		depth++
+	}
+	return depth
+}
+
+// Hook pauses the program at a statement when a breakpoint or a step asks
+// for it, and waits until the client resumes it
+func (d *Debugger) Hook(node interface{}, ctx *Context) {
+	// Code run by the debugger itself never pauses, it's only set while
+	// the program waits for the debugger so it needs no lock
+	if d.evaluating || !d.Statements[node] {
+		return
+	}
+	sp, _ := FirstPosition(node)
+	ctx.Pos = sp
+
+	d.mu.Lock()
+	depth := contextDepth(ctx)
+
+	reason := ""
+	switch {
+	case d.pause:
+		reason = "pause"
+	case d.mode == debugStepIn,
+		d.mode == debugStepOver && depth <= d.depth,
+		d.mode == debugStepOut && depth < d.depth:
+		reason = "step"
+	}
+	if reason == "step" && !d.started {
+		reason = "entry"
+	}
+	d.started = true
+
+	if bp, ok := d.Breakpoints[sp.Line]; ok && reason == "" && d.FirstOnLine[sp.Line] == node {
+		reason = "breakpoint"
+		if bp.Condition != nil {
+			if val, err := d.eval(bp.Condition, ctx); err == nil && !val.IsTrue() {
+				reason = ""
+			}
+		}
+	}
+	if reason == "" {
+		d.mu.Unlock()
+		return
+	}
+
+	d.pause = false
+	d.frames = []*debugFrame{}
+	d.handles = []interface{}{}
+	for c := ctx; c != nil; c = c.Parent {
+		if c.Pos != nil {
+			d.frames = append(d.frames, &debugFrame{c, c.Pos})
+		}
+	}
+	d.mu.Unlock()
+
+	d.event("stopped", map[string]interface{}{"reason": reason, "threadId": 1, "allThreadsStopped": true})
+	mode := <-d.resume
+
+	d.mu.Lock()
+	d.mode = mode
+	d.depth = depth
+	d.frames = nil
+	d.mu.Unlock()
+}
+
+func (d *Debugger) send(msg map[string]interface{}) {
+	d.outMu.Lock()
+	defer d.outMu.Unlock()
+	d.seq++
+	msg["seq"] = d.seq
+	WriteMessage(d.out, msg)
+}
+
+func (d *Debugger) event(name string, body interface{}) {
+	d.send(map[string]interface{}{"type": "event", "event": name, "body": body})
+}
+
+func (d *Debugger) respond(req *dapRequest, body interface{}, err error) {
+	msg := map[string]interface{}{
+		"type": "response",
+		"request_seq": req.Seq,
+		"command": req.Command,
+		"success": err == nil,
+	}
+	if err != nil {
+		msg["message"] = err.Error()
+	} else if body != nil {
+		msg["body"] = body
+	}
+	d.send(msg)
+}
+
+// Load parses the program and finds its statements
+func (d *Debugger) Load(program string) error {
+	content, err := os.ReadFile(program)
+	if err != nil {
+		return fmt.Errorf("Failed to load file %v", program)
+	}
+
+	ast, parseErr := Parse(program, string(content))
+	if parseErr != nil {
+		return fmt.Errorf("%v: %v", parseErr.Name, parseErr.Details)
+	}
+
+	d.Program, d.Source, d.AST = program, string(content), ast
+	for _, stmt := range StatementNodes(ast) {
+		d.addStatement(stmt)
+	}
+	return nil
+}
+
+// SetBreakpoints replaces the breakpoints, one on a line without a statement
+// moves to the next line that has one
+func (d *Debugger) SetBreakpoints(lines []int, conditions []string) []map[string]interface{} {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	statementLines := []int{}
+	for line := range d.FirstOnLine {
+		statementLines = append(statementLines, line)
+	}
+	sort.Ints(statementLines)
+
+	d.Breakpoints = map[int]*debugBreakpoint{}
+	result := []map[string]interface{}{}
+	for i, line := range lines {
+		bp := map[string]interface{}{"verified": false, "line": line}
+		result = append(result, bp)
+
+		at := sort.SearchInts(statementLines, line)
+		if at == len(statementLines) {
+			bp["message"] = "There is no code on or after this line"
+			continue
+		}
+		line = statementLines[at]
+
+		var cond interface{}
+		if strings.TrimSpace(conditions[i]) != "" {
+			ast, err := Parse("<condition>", conditions[i])
+			if err != nil {
+				bp["message"] = err.Name + ": " + err.Details
+				continue
+			}
+			cond = ast
+		}
+		d.Breakpoints[line] = &debugBreakpoint{line, cond}
+		bp["verified"] = true
+		bp["line"] = line
+	}
+	return result
+}
+
+// handle returns a reference that the client uses to ask for the variables
+// of a symbol table, a list or a map
+func (d *Debugger) handle(val interface{}) int {
+	d.handles = append(d.handles, val)
+	return len(d.handles)
+}
+
+func (d *Debugger) variable(name string, val Value) map[string]interface{} {
+	v := map[string]interface{}{"name": name, "value": Repr(val), "type": TypeName(val), "variablesReference": 0}
+	switch val.(type) {
+	case *List, *Map:
+		v["variablesReference"] = d.handle(val)
+	}
+	return v
+}
+
+// Variables returns the variables behind a reference, the builtins every
+// symbol table starts with are left out
+func (d *Debugger) Variables(ref int) []map[string]interface{} {
+	vars := []map[string]interface{}{}
+	if ref < 1 || ref > len(d.handles) {
+		return vars
+	}
+
+	switch val := d.handles[ref - 1].(type) {
+	case *SymbolTable:
+		names := []string{}
+		for name, v := range val.Symbols {
+			if _, isBuiltin := v.(*BuiltinFunction); !isBuiltin && name != "true" && name != "false" {
+				names = append(names, name)
+			}
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			vars = append(vars, d.variable(name, val.Symbols[name]))
+		}
+	case *List:
+		for i, el := range val.Elements {
+			vars = append(vars, d.variable(fmt.Sprintf("[%v]", i), el.(Value)))
+		}
+	case *Map:
+		for _, key := range val.Keys {
+			vars = append(vars, d.variable(key, val.Values[key]))
+		}
+	}
+	return vars
+}
+
+// eval runs some code without pausing and returns the value of its last
+// statement
+func (d *Debugger) eval(ast interface{}, ctx *Context) (Value, *Error) {
+	d.evaluating = true
+	res := NewInterpretor().Visit(ast, ctx)
+	d.evaluating = false
+	if res.Error != nil {
+		return nil, res.Error
+	}
+
+	vals := res.Value.(*List).Elements
+	if len(vals) == 0 {
+		return NewNull(), nil
+	}
+	return vals[len(vals) - 1].(Value), nil
+}
+
+// Evaluate runs an expression in a frame of the paused program
+func (d *Debugger) Evaluate(expr string, frame int) (string, int, error) {
+	ctx := globalDebugContext
+	if frame >= 1 && frame <= len(d.frames) {
+		ctx = d.frames[frame - 1].Ctx
+	}
+
+	ast, err := Parse("<eval>", expr)
+	if err != nil {
+		return "", 0, fmt.Errorf("%v: %v", err.Name, err.Details)
+	}
+
+	val, runErr := d.eval(ast, ctx)
+	if runErr != nil {
+		return "", 0, fmt.Errorf("%v: %v", runErr.Name, runErr.Details)
+	}
+	ref := 0
+	switch val.(type) {
+	case *List, *Map:
+		ref = d.handle(val)
+	}
+	return Repr(val), ref, nil
+}
+
+var globalDebugContext *Context
+
+// Run runs the program and tells the client when it ends, the output of the
+// program is sent to the client as it's printed
+func (d *Debugger) Run(output *os.File, wait func()) {
+	ctx := NewContext("<root>")
+	ctx.SymbolTable = globalSymbolTable
+	globalDebugContext = ctx
+
+	if d.StopOnEntry {
+		d.mode = debugStepIn
+	}
+	DebugHook = d.Hook
+
+	res := NewInterpretor().Visit(d.AST, ctx)
+	DebugHook = nil
+
+	exitCode := 0
+	if res.Error != nil {
+		fmt.Println(res.Error)
+		exitCode = 1
+	}
+
+	output.Close()
+	wait()
+	d.event("exited", map[string]interface{}{"exitCode": exitCode})
+	d.event("terminated", map[string]interface{}{})
+}
+
+// Serve handles requests from the client until it disconnects
+func (d *Debugger) Serve(in *bufio.Reader) {
+	// The program prints to a pipe so its output doesn't mix with the
+	// messages, and it gets no input since stdin belongs to the client
+	r, w, err := os.Pipe()
+	if err != nil {
+		return
+	}
+	os.Stdout = w
+	stdin = bufio.NewReader(strings.NewReader(""))
+
+	done := make(chan bool)
+	go func() {
+		buf := make([]byte, 4096)
+		for {
+			n, err := r.Read(buf)
+			if n > 0 {
+				d.event("output", map[string]interface{}{"category": "stdout", "output": string(buf[:n])})
+			}
+			if err != nil {
+				close(done)
+				return
+			}
+		}
+	}()
+
+	for {
+		content, err := ReadMessage(in)
+		if err != nil {
+			return
+		}
+		req := &dapRequest{}
+		if json.Unmarshal(content, req) != nil {
+			continue
+		}
+
+		args := map[string]interface{}{}
+		json.Unmarshal(req.Arguments, &args)
+		number := func(name string) int {
+			n, _ := args[name].(float64)
+			return int(n)
+		}
+
+		switch req.Command {
+		case "initialize":
+			d.respond(req, map[string]interface{}{
+				"supportsConfigurationDoneRequest": true,
+				"supportsConditionalBreakpoints": true,
+				"supportsEvaluateForHovers": true,
+			}, nil)
+			d.event("initialized", map[string]interface{}{})
+		case "launch":
+			program, _ := args["program"].(string)
+			d.StopOnEntry, _ = args["stopOnEntry"].(bool)
+			EnforceTypes, _ = args["checkTypes"].(bool)
+			if err := d.Load(program); err != nil {
+				d.respond(req, nil, err)
+				d.event("terminated", map[string]interface{}{})
+				continue
+			}
+			d.respond(req, nil, nil)
+		case "setBreakpoints":
+			bps := &struct {
+				Source struct {
+					Path string `json:"path"`
+				} `json:"source"`
+				Breakpoints []struct {
+					Line int `json:"line"`
+					Condition string `json:"condition"`
+				} `json:"breakpoints"`
+			}{}
+			json.Unmarshal(req.Arguments, bps)
+
+			lines, conditions := []int{}, []string{}
+			for _, bp := range bps.Breakpoints {
+				lines = append(lines, bp.Line)
+				conditions = append(conditions, bp.Condition)
+			}
+			if d.Program == "" {
+				if err := d.Load(bps.Source.Path); err != nil {
+					d.respond(req, nil, err)
+					continue
+				}
+			}
+			if !samePath(bps.Source.Path, d.Program) {
+				lines, conditions = nil, nil
+			}
+			d.respond(req, map[string]interface{}{"breakpoints": d.SetBreakpoints(lines, conditions)}, nil)
+		case "configurationDone":
+			d.respond(req, nil, nil)
+			if d.AST != nil {
+				go d.Run(w, func() { <-done })
+			}
+		case "threads":
+			d.respond(req, map[string]interface{}{
+				"threads": []map[string]interface{}{{"id": 1, "name": "main"}},
+			}, nil)
+		case "stackTrace":
+			d.mu.Lock()
+			frames := []map[string]interface{}{}
+			for i, frame := range d.frames {
+				line, column := lintLocation(frame.Pos)
+				frames = append(frames, map[string]interface{}{
+					"id": i + 1,
+					"name": frame.Ctx.Name,
+					"line": line,
+					"column": column,
+					"source": map[string]interface{}{"name": filepath.Base(d.Program), "path": d.Program},
+				})
+			}
+			d.mu.Unlock()
+			d.respond(req, map[string]interface{}{"stackFrames": frames, "totalFrames": len(frames)}, nil)
+		case "scopes":
+			d.mu.Lock()
+			scopes := []map[string]interface{}{}
+			if frame := number("frameId"); frame >= 1 && frame <= len(d.frames) {
+				ctx := d.frames[frame - 1].Ctx
+				name := "Locals"
+				if ctx.Parent == nil {
+					name = "Globals"
+				}
+				scopes = append(scopes, map[string]interface{}{
+					"name": name,
+					"variablesReference": d.handle(ctx.SymbolTable),
+					"expensive": false,
+				})
+			}
+			d.mu.Unlock()
+			d.respond(req, map[string]interface{}{"scopes": scopes}, nil)
+		case "variables":
+			d.mu.Lock()
+			vars := d.Variables(number("variablesReference"))
+			d.mu.Unlock()
+			d.respond(req, map[string]interface{}{"variables": vars}, nil)
+		case "evaluate":
+			expr, _ := args["expression"].(string)
+			d.mu.Lock()
+			if d.frames == nil {
+				d.mu.Unlock()
+				d.respond(req, nil, fmt.Errorf("The program isn't paused"))
+				continue
+			}
+			result, ref, err := d.Evaluate(expr, number("frameId"))
+			d.mu.Unlock()
+			d.respond(req, map[string]interface{}{"result": result, "variablesReference": ref}, err)
+		case "continue", "next", "stepIn", "stepOut":
+			mode := map[string]debugMode{
+				"continue": debugContinue,
+				"next": debugStepOver,
+				"stepIn": debugStepIn,
+				"stepOut": debugStepOut,
+			}[req.Command]
+			body := map[string]interface{}{}
+			if req.Command == "continue" {
+				body["allThreadsContinued"] = true
+			}
+			d.respond(req, body, nil)
+
+			d.mu.Lock()
+			paused := d.frames != nil
+			d.mu.Unlock()
+			if paused {
+				d.resume <- mode
+			}
+		case "pause":
+			d.mu.Lock()
+			d.pause = true
+			d.mu.Unlock()
+			d.respond(req, nil, nil)
+		case "disconnect", "terminate":
+			d.respond(req, nil, nil)
+			os.Exit(0)
+		default:
+			d.respond(req, nil, fmt.Errorf("Unsupported request '%v'", req.Command))
+		}
+	}
+}
+
+func samePath(a, b string) bool {
+	absA, errA := filepath.Abs(a)
+	absB, errB := filepath.Abs(b)
+	return errA == nil && errB == nil && absA == absB
+}
+
+// ServeDAP runs the debug adapter on the standard input and output
+func ServeDAP() {
+	NewDebugger(os.Stdout).Serve(stdin)
+}
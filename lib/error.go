@@ -6,6 +6,9 @@ type Error struct {
 	Name, Details string
 	StartPos *Position
 	EndPos *Position
+	// Incomplete is set on errors of input that ends too early, like a string
+	// that's never closed, more input can still fix them
+	Incomplete bool
 }
 
 func NewError(n, d string, sp, ep *Position) *Error {
@@ -58,3 +61,13 @@ func NewRuntimeError(d string, sp, ep *Position) *Error {
 	e := NewError("Runtime Error", d, sp, ep)
 	return e
 }
+
+func NewTypeError(d string, sp, ep *Position) *Error {
+	e := NewError("Type Error", d, sp, ep)
+	return e
+}
+
+func NewAssertionError(d string, sp, ep *Position) *Error {
+	e := NewError("Assertion Error", d, sp, ep)
+	return e
+}
@@ -0,0 +1,483 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// CSTNode is a node of the concrete syntax tree used by the formatter, unlike
+// the AST it keeps every token including comments and newlines. A group is
+// made of the tokens between a pair of brackets
+type CSTNode struct {
+	Token *Token
+	Children []*CSTNode
+	Close *Token
+}
+
+func (n *CSTNode) IsGroup() bool {
+	return n.Children != nil
+}
+
+var closingBrackets = map[string]string{"(": ")", "[": "]", "?[": "]", "{": "}"}
+
+// BuildCST groups tokens by their brackets, the root group holds the whole
+// file and has no brackets
+func BuildCST(tokens []*Token) (*CSTNode, *Error) {
+	root := &CSTNode{Children: []*CSTNode{}}
+	stack := []*CSTNode{root}
+
+	for _, tok := range tokens {
+		if tok.Type == TTEOF {
+			break
+		}
+		top := stack[len(stack) - 1]
+
+		if tok.Type == TTOp {
+			val := tok.Value.(string)
+			if _, ok := closingBrackets[val]; ok {
+				group := &CSTNode{Token: tok, Children: []*CSTNode{}}
+				top.Children = append(top.Children, group)
+				stack = append(stack, group)
+				continue
+			}
+			if val == ")" || val == "]" || val == "}" {
+				if len(stack) == 1 || closingBrackets[top.Token.Value.(string)] != val {
+					return nil, NewInvalidSyntaxError(fmt.Sprintf("Unexpected '%v'", val), tok.StartPos, tok.EndPos)
+				}
+				top.Close = tok
+				stack = stack[:len(stack) - 1]
+				continue
+			}
+		}
+
+		top.Children = append(top.Children, &CSTNode{Token: tok})
+	}
+
+	if len(stack) > 1 {
+		open := stack[len(stack) - 1].Token
+		return nil, NewInvalidSyntaxError(
+			fmt.Sprintf("Expected '%v'", closingBrackets[open.Value.(string)]), open.StartPos, open.EndPos)
+	}
+
+	return root, nil
+}
+
+// HeaderKeywords start statements that end with a block
+var HeaderKeywords = []string{"if", "elif", "else", "while", "for", "each", "loop", "do", "match", "fun"}
+
+// fmtGroup is the state of a group while it's being printed
+type fmtGroup struct {
+	Node *CSTNode
+	Indent int
+	IsBlock bool
+	// The keyword of a statement waiting for its block
+	Header string
+	Ternaries int
+	ForHeader bool
+	// The first token of the current line
+	LineStart *Token
+}
+
+// Formatter prints a CST in the canonical style: two spaces for each level of
+// indentation, single spaces around operators, at most one blank line and
+// blocks opening on the line of their statement
+type Formatter struct {
+	Source string
+	sb strings.Builder
+	groups []*fmtGroup
+	prev *Token
+	prevUnary bool
+	prevNullable bool
+	prevTightColon bool
+	lineIndent int
+	atLineStart bool
+	newLines int
+	semicolon bool
+	started bool
+	justOpened bool
+}
+
+func NewFormatter(src string) *Formatter {
+	f := &Formatter{
+		Source: src,
+		atLineStart: true,
+	}
+	return f
+}
+
+// Format formats a Luminary source file, code that doesn't parse isn't
+// formatted
+func Format(fn, src string) (string, *Error) {
+	ast, err := Parse(fn, src)
+	if err != nil {
+		return "", err
+	}
+
+	lexer := NewLexer(src, fn, src)
+	lexer.KeepComments = true
+	tokens, err := lexer.MakeTokens()
+	if err != nil {
+		return "", err
+	}
+	tokens = SplitIncrements(tokens)
+
+	cst, err := BuildCST(tokens)
+	if err != nil {
+		return "", err
+	}
+
+	f := NewFormatter(src)
+	f.groups = []*fmtGroup{{Node: cst, Indent: -1}}
+	f.PrintChildren(cst)
+	out := f.String()
+
+	// Formatting must never change what the code does
+	formatted, err := Parse(fn, out)
+	if err != nil || DumpAST(formatted) != DumpAST(ast) {
+		return "", NewError("Format Error", "Formatting changed the meaning of the code, it was left unchanged", nil, nil)
+	}
+
+	return out, nil
+}
+
+func (f *Formatter) String() string {
+	out := f.sb.String()
+	if out == "" {
+		return ""
+	}
+	return out + "\n"
+}
+
+func (f *Formatter) Text(t *Token) string {
+	if t.Type == TTComment {
+		return t.Value.(string)
+	}
+	return f.Source[t.StartPos.Index:t.EndPos.Index]
+}
+
+func (f *Formatter) group() *fmtGroup {
+	return f.groups[len(f.groups) - 1]
+}
+
+func (f *Formatter) PrintSubGroup(node *CSTNode) {
+	g := f.group()
+	open := node.Token.Value.(string)
+	isBlock := open == "{" && f.IsBlockBrace()
+
+	// A block's '{' goes on the line of its statement
+	if isBlock && f.newLines > 0 {
+		f.newLines = 0
+	}
+
+	f.PrintToken(node.Token, nil)
+	if isBlock {
+		g.Header = ""
+		g.ForHeader = false
+	}
+
+	inner := &fmtGroup{Node: node, Indent: f.lineIndent, IsBlock: isBlock}
+	f.groups = append(f.groups, inner)
+	f.PrintChildren(node)
+	f.groups = f.groups[:len(f.groups) - 1]
+
+	if f.newLines > 0 {
+		f.newLines = 1
+	}
+	f.semicolon = false
+	f.PrintClose(node, inner)
+}
+
+func (f *Formatter) PrintChildren(node *CSTNode) {
+	for i, child := range node.Children {
+		var next *Token
+		if i + 1 < len(node.Children) {
+			next = node.Children[i + 1].Token
+		}
+
+		if child.IsGroup() {
+			f.PrintSubGroup(child)
+			continue
+		}
+
+		tok := child.Token
+		if tok.Type == TTNewLine {
+			if tok.Value == ";" {
+				f.semicolon = true
+			} else {
+				f.newLines++
+			}
+			continue
+		}
+
+		f.PrintToken(tok, next)
+	}
+}
+
+func (f *Formatter) PrintClose(node *CSTNode, inner *fmtGroup) {
+	if f.newLines > 0 {
+		f.newLines = 0
+		f.writeNewLines(1)
+		f.lineIndent = inner.Indent
+		f.writeIndent()
+	} else if inner.IsBlock && f.prev != node.Token {
+		f.sb.WriteString(" ")
+	}
+	f.write(node.Close)
+}
+
+// IsBlockBrace reports whether a '{' about to be printed opens a block rather
+// than a map
+func (f *Formatter) IsBlockBrace() bool {
+	g := f.group()
+	p := f.prev
+	if p == nil {
+		return false
+	}
+	if f.newLines > 0 && (g.LineStart == nil || g.LineStart.Type != TTKeyword) {
+		return false
+	}
+	if p.Type == TTKeyword {
+		return p.Value == "loop" || p.Value == "do" || p.Value == "else"
+	}
+	if p.Type == TTOp && p.Value == "=>" {
+		return true
+	}
+	if p.Type == TTOp && !Contains([]string{")", "]", "}", "?"}, p.Value.(string)) {
+		return false
+	}
+	return g.Header != ""
+}
+
+func (f *Formatter) writeNewLines(n int) {
+	f.sb.WriteString(strings.Repeat("\n", n))
+	f.atLineStart = true
+}
+
+func (f *Formatter) writeIndent() {
+	if f.lineIndent > 0 {
+		f.sb.WriteString(strings.Repeat("  ", f.lineIndent))
+	}
+}
+
+func (f *Formatter) write(t *Token) {
+	f.sb.WriteString(f.Text(t))
+	f.prev = t
+	f.atLineStart = false
+	f.started = true
+	f.justOpened = t.Type == TTOp && closingBrackets[t.Value.(string)] != ""
+}
+
+// IsContinuation reports whether a token at the start of a line continues
+// the expression of the previous line
+func IsContinuation(t *Token) bool {
+	if t.Type == TTKeyword {
+		return t.Value == "and" || t.Value == "or" || t.Value == "is"
+	}
+	if t.Type != TTOp {
+		return false
+	}
+	return Contains([]string{"*", "/", "%", "^", "==", "!=", "<", "<=", ">", ">=", "??", "?", ":", ".", "?.", ".."}, t.Value.(string))
+}
+
+// isNullable reports whether a '?' followed by a token marks a nullable type,
+// the last token of a group is followed by nothing
+func isNullable(next *Token) bool {
+	return next == nil || EndsType(next)
+}
+
+// EndsWithOperator reports whether a line ending with a token continues on
+// the next line
+func EndsWithOperator(t *Token) bool {
+	if t == nil {
+		return false
+	}
+	if t.Type == TTKeyword {
+		return Contains([]string{"and", "or", "not", "is"}, t.Value)
+	}
+	if t.Type != TTOp {
+		return false
+	}
+	return !Contains([]string{")", "]", "}", ",", "++", "--", "(", "[", "?[", "{"}, t.Value.(string))
+}
+
+func (f *Formatter) PrintToken(tok *Token, next *Token) {
+	g := f.group()
+
+	if f.newLines > 0 {
+		n := f.newLines
+		if n > 2 {
+			n = 2
+		}
+		if !f.started {
+			n = 0
+		} else if f.justOpened {
+			n = 1
+		}
+		f.newLines = 0
+		f.semicolon = false
+
+		// Only a statement starting with a keyword like `if` can have its
+		// block on the next line
+		if g.LineStart == nil || g.LineStart.Type != TTKeyword || !Contains(HeaderKeywords, g.LineStart.Value) {
+			g.Header = ""
+			g.ForHeader = false
+		}
+
+		if n > 0 {
+			f.writeNewLines(n)
+		}
+		f.lineIndent = g.Indent + 1
+		if IsContinuation(tok) || (EndsWithOperator(f.prev) && !f.prevNullable) {
+			f.lineIndent++
+		}
+		f.writeIndent()
+		g.LineStart = tok
+	} else if f.semicolon {
+		f.semicolon = false
+		f.sb.WriteString(";")
+		f.atLineStart = false
+		g.LineStart = tok
+		g.Header = ""
+	} else if !f.started {
+		g.LineStart = tok
+		f.lineIndent = g.Indent + 1
+	}
+
+	if tok.Type == TTComment {
+		if !f.atLineStart {
+			f.sb.WriteString(f.commentGap(tok))
+		}
+		f.sb.WriteString(f.Text(tok))
+		f.atLineStart = false
+		f.started = true
+		f.justOpened = false
+		return
+	}
+
+	if !f.atLineStart && f.NeedsSpace(tok, next) {
+		f.sb.WriteString(" ")
+	}
+
+	unary := f.isUnary(tok)
+	tightColon := false
+	if tok.Type == TTOp && tok.Value == ":" {
+		tightColon = f.isSliceColon()
+		if f.isSpacedColon() && g.Ternaries > 0 {
+			g.Ternaries--
+		}
+	}
+
+	f.write(tok)
+	f.prevNullable = tok.Type == TTOp && tok.Value == "?" && isNullable(next)
+	f.prevUnary = unary
+	f.prevTightColon = tightColon
+
+	switch {
+	case tok.Type == TTKeyword && Contains(HeaderKeywords, tok.Value):
+		if tok.Value == "for" {
+			g.ForHeader = true
+		}
+		if g.Header == "" || tok.Value != "fun" {
+			g.Header = tok.Value.(string)
+		}
+	case tok.Type == TTOp && tok.Value == "=" && g.Header == "fun":
+		// A function with an expression body has no block
+		g.Header = ""
+	case tok.Type == TTOp && tok.Value == "?" && !isNullable(next):
+		g.Ternaries++
+	}
+}
+
+// commentGap keeps the spaces between a trailing comment and the code before
+// it so aligned comments stay aligned
+func (f *Formatter) commentGap(tok *Token) string {
+	i := tok.StartPos.Index
+	for i > 0 && (f.Source[i - 1] == ' ' || f.Source[i - 1] == '\t') {
+		i--
+	}
+	gap := strings.Count(f.Source[i:tok.StartPos.Index], " ")
+	if gap < 1 {
+		gap = 1
+	}
+	return strings.Repeat(" ", gap)
+}
+
+func (f *Formatter) isUnary(tok *Token) bool {
+	if tok.Type != TTOp || (tok.Value != "-" && tok.Value != "+") {
+		return false
+	}
+	p := f.prev
+	if p == nil || f.atLineStart || p.Type == TTKeyword {
+		return true
+	}
+	return p.Type == TTOp && !Contains([]string{")", "]", "}", "++", "--"}, p.Value.(string))
+}
+
+// isSliceColon reports whether a ':' is part of a slice like xs[1:3]
+func (f *Formatter) isSliceColon() bool {
+	g := f.group()
+	return g.Node.Token != nil && g.Node.Token.Value != "{" && g.Node.Token.Value != "("
+}
+
+// isSpacedColon reports whether a ':' belongs to a ternary operator or a for
+// loop, other colons like the ones of maps and types only have a space after
+// them
+func (f *Formatter) isSpacedColon() bool {
+	g := f.group()
+	return !f.isSliceColon() && (g.Ternaries > 0 || g.ForHeader)
+}
+
+func isValueToken(t *Token) bool {
+	switch t.Type {
+	case TTId, TTNum, TTStr, TTNull:
+		return true
+	case TTOp:
+		return Contains([]string{")", "]", "}"}, t.Value.(string))
+	}
+	return false
+}
+
+// NeedsSpace reports whether a space goes between the previous token and tok
+func (f *Formatter) NeedsSpace(tok, next *Token) bool {
+	p := f.prev
+	if p == nil {
+		return false
+	}
+	cur := ""
+	if tok.Type == TTOp {
+		cur = tok.Value.(string)
+	}
+	prev := ""
+	if p.Type == TTOp {
+		prev = p.Value.(string)
+	}
+
+	switch {
+	case cur == ",":
+		return false
+	case prev == "(" || prev == "[" || prev == "?[":
+		return false
+	case prev == "{":
+		return f.group().IsBlock
+	case Contains([]string{".", "?.", "?[", "..", "..<", "++", "--"}, cur):
+		return false
+	case Contains([]string{".", "?.", "..", "..<", "..."}, prev):
+		return false
+	case f.prevUnary:
+		return false
+	case cur == "(":
+		if p.Type == TTKeyword {
+			return p.Value != "fun"
+		}
+		return !isValueToken(p) || prev == "}"
+	case cur == "[":
+		return !isValueToken(p)
+	case cur == ":":
+		return f.isSpacedColon()
+	case prev == ":":
+		return !f.prevTightColon
+	case cur == "?" && isNullable(next):
+		return false
+	}
+	return true
+}
@@ -2,24 +2,39 @@ package main
 
 import "fmt"
 
+type KeywordArg struct {
+	Name string
+	Value Value
+}
+
 type Function struct {
 	Name string
 	ArgNames []string
+	Params []*ParamNode
 	Body interface{}
 	ReturnBody bool
+	IsGenerator bool
+	ReturnType *TypeNode
 	StartPos, EndPos *Position
 }
 
-func NewFunction(n string, a []string, b interface{}, sh bool) Value {
+func NewFunction(n string, a []*ParamNode, b interface{}, sh bool, g bool) Value {
 	if n == "" {
 		n = "anonymous"
 	}
 
+	argNames := []string{}
+	for _, param := range a {
+		argNames = append(argNames, param.String())
+	}
+
 	f := &Function{
 		Name: n,
-		ArgNames: a,
+		ArgNames: argNames,
+		Params: a,
 		Body: b,
 		ReturnBody: sh,
+		IsGenerator: g,
 	}
 
 	return f
@@ -96,28 +111,6 @@ func (f *Function) IsLessThanOrEqual(other interface{}) (Value, *Error) {
 	return nil, NewRuntimeError("Can't compare functions", f.StartPos, nil)
 }
 
-func (f *Function) And(other interface{}) (Value, *Error) {
-	if o, ok := other.(Value); ok {
-		if o.IsTrue() {
-			return o, nil
-		}
-		return NewNumber(0), nil
-	}
-
-	return nil, NewRuntimeError("Can't compare values of different types", f.StartPos, nil)
-}
-
-func (f *Function) Or(other interface{}) (Value, *Error) {
-	if o, ok := other.(Value); ok {
-		if o.IsTrue() {
-			return o, nil
-		}
-		return f, nil
-	}
-
-	return nil, NewRuntimeError("Can't compare values of different types", f.StartPos, nil)
-}
-
 func (f *Function) Not() Value {
 	return NewNumber(0)
 }
@@ -131,6 +124,11 @@ func (f *Function) GetVal() interface{} {
 }
 
 func (f *Function) Call(args []interface{}, ctx *Context) *RuntimeResult {
+	if ActiveProfile != nil {
+		ActiveProfile.Enter(f.Name)
+		defer ActiveProfile.Exit()
+	}
+
 	rr := NewRuntimeResult()
 	i := NewInterpretor()
 	newCtx := NewContext(f.Name)
@@ -138,14 +136,87 @@ func (f *Function) Call(args []interface{}, ctx *Context) *RuntimeResult {
 	newCtx.SymbolTable = NewSymbolTable()
 	newCtx.SymbolTable.Parent = newCtx.Parent.SymbolTable
 
-	for key, argVal := range args {
-		argName := f.ArgNames[key]
-		newCtx.SymbolTable.Set(argName, argVal.(Value))
+	positional := []interface{}{}
+	keywords := map[string]Value{}
+
+	for _, arg := range args {
+		if kw, ok := arg.(*KeywordArg); ok {
+			if _, ok := keywords[kw.Name]; ok {
+				return rr.Failure(NewRuntimeError(
+					fmt.Sprintf("%v got multiple values for the argument '%v'", f, kw.Name), f.StartPos, f.EndPos))
+			}
+			keywords[kw.Name] = kw.Value
+			continue
+		}
+		positional = append(positional, arg)
+	}
+
+	for key, param := range f.Params {
+		var argVal Value = nil
+
+		if param.Variadic {
+			rest := []interface{}{}
+			if key < len(positional) {
+				rest = append(rest, positional[key:]...)
+			}
+			if EnforceTypes {
+				err := CheckValueType(fmt.Sprintf("the argument '%v' of %v", param.Name, f), NewList(rest), param.Type, f.StartPos, f.EndPos)
+				if err != nil {
+					return rr.Failure(err)
+				}
+			}
+			newCtx.SymbolTable.Set(param.Name, NewList(rest))
+			break
+		}
+
+		if kw, ok := keywords[param.Name]; ok {
+			if key < len(positional) {
+				return rr.Failure(NewRuntimeError(
+					fmt.Sprintf("%v got multiple values for the argument '%v'", f, param.Name), f.StartPos, f.EndPos))
+			}
+			argVal = kw
+			delete(keywords, param.Name)
+		} else if key < len(positional) {
+			argVal = positional[key].(Value)
+		} else if param.Default != nil {
+			argVal = rr.Register(i.Visit(param.Default, newCtx))
+			if rr.ShouldReturn() {
+				return rr
+			}
+		} else {
+			return rr.Failure(NewRuntimeError(
+				fmt.Sprintf("%v expected %v, got %v", f, f.Arity(), len(positional)), f.StartPos, f.EndPos))
+		}
+
+		if EnforceTypes {
+			err := CheckValueType(fmt.Sprintf("the argument '%v' of %v", param.Name, f), argVal, param.Type, f.StartPos, f.EndPos)
+			if err != nil {
+				return rr.Failure(err)
+			}
+		}
+
+		if param.Pattern != nil {
+			err := i.Destructure(param.Pattern, argVal, newCtx)
+			if err != nil {
+				return rr.Failure(err)
+			}
+			continue
+		}
+		newCtx.SymbolTable.Set(param.Name, argVal)
+	}
+
+	if !f.IsVariadic() && len(positional) > len(f.Params) {
+		return rr.Failure(NewRuntimeError(
+			fmt.Sprintf("%v expected %v, got %v", f, f.Arity(), len(positional)), f.StartPos, f.EndPos))
 	}
 
-	if len(args) != len(f.ArgNames) {
+	for name := range keywords {
 		return rr.Failure(NewRuntimeError(
-			fmt.Sprintf("Expected %v arguements, got %v", len(f.ArgNames), len(args)), f.StartPos, f.EndPos))
+			fmt.Sprintf("%v got an unexpected keyword argument '%v'", f, name), f.StartPos, f.EndPos))
+	}
+
+	if f.IsGenerator {
+		return rr.Success(NewGenerator(f, f.Body, newCtx))
 	}
 
 	val := rr.Register(i.Visit(f.Body, newCtx))
@@ -154,18 +225,61 @@ func (f *Function) Call(args []interface{}, ctx *Context) *RuntimeResult {
 		return rr
 	}
 
+	var ret Value = NewNull()
 	if f.ReturnBody {
-		return rr.Success(val)
+		ret = val
+	} else if rr.FunReturnValue != nil {
+		ret = rr.FunReturnValue
+	}
+
+	if EnforceTypes {
+		err := CheckValueType(fmt.Sprintf("the return value of %v", f), ret, f.ReturnType, f.StartPos, f.EndPos)
+		if err != nil {
+			return rr.Failure(err)
+		}
+	}
+
+	return rr.Success(ret)
+}
+
+func (f *Function) IsVariadic() bool {
+	return len(f.Params) > 0 && f.Params[len(f.Params) - 1].Variadic
+}
+
+func (f *Function) Arity() string {
+	required := 0
+	total := 0
+	for _, param := range f.Params {
+		if param.Variadic {
+			continue
+		}
+		total += 1
+		if param.Default == nil {
+			required += 1
+		}
 	}
 
-	if rr.FunReturnValue != nil {
-		return rr.Success(rr.FunReturnValue)
+	plural := func(n int) string {
+		if n == 1 {
+			return "1 argument"
+		}
+		return fmt.Sprintf("%v arguments", n)
 	}
 
-	return rr.Success(NewNull())
+	if f.IsVariadic() {
+		return "at least " + plural(required)
+	}
+	if required != total {
+		return fmt.Sprintf("%v to %v", required, plural(total))
+	}
+	return plural(total)
 }
 
 func (f *Function) AccessElement(index int, to interface{}, ctx *Context) *RuntimeResult {
 	rr := NewRuntimeResult()
 	return rr.Failure(NewRuntimeError("Can't access element from a function", f.StartPos, f.EndPos))
 }
+
+func (f *Function) Iter() (*Iterator, *Error) {
+	return nil, NewRuntimeError("Can't iterate over a function", f.StartPos, f.EndPos)
+}
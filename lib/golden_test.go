@@ -0,0 +1,177 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// The golden tests run every program in testdata and in the examples and
+// compare what it prints and its exit code with the files next to it:
+//
+//   name.lum     the program
+//   name.args    arguments to pass before the file, like `run --check-types`
+//   name.stdin   the standard input of the program
+//   name.stdout  the expected standard output
+//   name.stderr  the expected standard error, empty when missing
+//   name.exit    the expected exit code, 0 when missing
+//
+// The golden files of the examples live in testdata/examples. Running
+// `go test -update` writes the golden files from the current output
+
+var update = flag.Bool("update", false, "write the golden files from the current output")
+
+// goldenBackends are the ways of running a program which all have to give the
+// golden output, the first one writes the golden files on -update
+var goldenBackends = []struct {
+	Name string
+	Env []string
+}{
+	{"tree-walker", nil},
+}
+
+// goldenMainEnv makes the test binary run as luminary itself, so the programs
+// run through main like they do for users
+const goldenMainEnv = "LUMINARY_GOLDEN_MAIN"
+
+func TestMain(m *testing.M) {
+	if os.Getenv(goldenMainEnv) == "1" {
+		main()
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+type goldenCase struct {
+	Program string
+	// Golden is the path of the golden files without an extension
+	Golden string
+}
+
+func goldenCases(t *testing.T) []goldenCase {
+	cases := []goldenCase{}
+	err := filepath.Walk("testdata", func(path string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() && strings.HasSuffix(path, ".lum") {
+			cases = append(cases, goldenCase{path, strings.TrimSuffix(path, ".lum")})
+		}
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	examples, err := filepath.Glob(filepath.Join("..", "examples", "*.lum"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range examples {
+		// Test files only define tests, `luminary test` runs them
+		if strings.HasSuffix(path, "_test.lum") {
+			continue
+		}
+		name := strings.TrimSuffix(filepath.Base(path), ".lum")
+		cases = append(cases, goldenCase{path, filepath.Join("testdata", "examples", name)})
+	}
+	return cases
+}
+
+// readGolden returns the content of a golden file, or def when it's missing
+func readGolden(t *testing.T, path, def string) string {
+	content, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return def
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(content)
+}
+
+// writeGolden writes a golden file, or removes it when its content is the
+// default one
+func writeGolden(t *testing.T, path, content, def string) {
+	if content == def {
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			t.Fatal(err)
+		}
+		return
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// runGolden runs a program the way `luminary` would and returns its output
+// and exit code
+func runGolden(t *testing.T, c goldenCase, env []string) (string, string, int) {
+	args := strings.Fields(readGolden(t, c.Golden + ".args", ""))
+	args = append(args, c.Program)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10 * time.Second)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, os.Args[0], args...)
+	cmd.Env = append(append(os.Environ(), goldenMainEnv + "=1"), env...)
+	cmd.Stdin = strings.NewReader(readGolden(t, c.Golden + ".stdin", ""))
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+
+	err := cmd.Run()
+	if ctx.Err() != nil {
+		t.Fatalf("%v didn't finish in time", c.Program)
+	}
+	code := 0
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		code = exitErr.ExitCode()
+	} else if err != nil {
+		t.Fatal(err)
+	}
+	return stdout.String(), stderr.String(), code
+}
+
+func TestGolden(t *testing.T) {
+	for i, backend := range goldenBackends {
+		i, backend := i, backend
+		t.Run(backend.Name, func(t *testing.T) {
+			for _, c := range goldenCases(t) {
+				c := c
+				t.Run(strings.TrimPrefix(filepath.ToSlash(c.Program), "../"), func(t *testing.T) {
+					t.Parallel()
+					stdout, stderr, code := runGolden(t, c, backend.Env)
+
+					if *update && i == 0 {
+						if err := os.MkdirAll(filepath.Dir(c.Golden), 0755); err != nil {
+							t.Fatal(err)
+						}
+						writeGolden(t, c.Golden + ".stdout", stdout, "")
+						writeGolden(t, c.Golden + ".stderr", stderr, "")
+						writeGolden(t, c.Golden + ".exit", strconv.Itoa(code) + "\n", "0\n")
+						return
+					}
+
+					for _, out := range []struct {
+						Name, Got, Want string
+					}{
+						{"stdout", stdout, readGolden(t, c.Golden + ".stdout", "")},
+						{"stderr", stderr, readGolden(t, c.Golden + ".stderr", "")},
+						{"exit code", strconv.Itoa(code) + "\n", readGolden(t, c.Golden + ".exit", "0\n")},
+					} {
+						if out.Got != out.Want {
+							t.Errorf("%v of %v differs from the golden file:\n%v", out.Name, c.Program,
+								UnifiedDiff(out.Want, out.Got, "golden", "got"))
+						}
+					}
+				})
+			}
+		})
+	}
+}
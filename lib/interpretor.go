@@ -1,5 +1,7 @@
 package main
 
+import "fmt"
+
 type Interpretor struct {}
 
 func NewInterpretor() *Interpretor {
@@ -12,7 +14,11 @@ type RuntimeResult struct {
 	FunReturnValue Value
 	ContinueLoop bool
 	BreakLoop bool
+	LoopLabel string
 	Error *Error
+	// SkipChain is set by a '?.' or '?[' link that was read from a null, the
+	// links chained after it are skipped
+	SkipChain bool
 }
 
 func NewRuntimeResult() *RuntimeResult {
@@ -24,9 +30,11 @@ func NewRuntimeResult() *RuntimeResult {
 func (rr *RuntimeResult) Reset() {
 	rr.BreakLoop = false
 	rr.ContinueLoop = false
+	rr.LoopLabel = ""
 	rr.FunReturnValue = nil
 	rr.Error = nil
 	rr.Value = nil
+	rr.SkipChain = false
 }
 
 func (rr *RuntimeResult) Register(res interface{}) Value {
@@ -37,6 +45,7 @@ func (rr *RuntimeResult) Register(res interface{}) Value {
 		rr.ContinueLoop = r.ContinueLoop
 		rr.FunReturnValue = r.FunReturnValue
 		rr.BreakLoop = r.BreakLoop
+		rr.LoopLabel = r.LoopLabel
 		return r.Value
 	} else if v, ok := res.(Value); ok {
 		return v
@@ -56,15 +65,17 @@ func (rr *RuntimeResult) SuccessReturn(val Value) *RuntimeResult {
 	return rr
 }
 
-func (rr *RuntimeResult) SuccessContinue() *RuntimeResult {
+func (rr *RuntimeResult) SuccessContinue(label string) *RuntimeResult {
 	rr.Reset()
 	rr.ContinueLoop = true
+	rr.LoopLabel = label
 	return rr
 }
 
-func (rr *RuntimeResult) SuccessBreak() *RuntimeResult {
+func (rr *RuntimeResult) SuccessBreak(label string) *RuntimeResult {
 	rr.Reset()
 	rr.BreakLoop = true
+	rr.LoopLabel = label
 	return rr
 }
 
@@ -78,7 +89,66 @@ func (rr *RuntimeResult) ShouldReturn() bool {
 	return rr.Error != nil || rr.FunReturnValue != nil || rr.ContinueLoop || rr.BreakLoop
 }
 
+// LoopSignal checks the result of a loop body for the loop with the given
+// label, a break or continue aimed at this loop is consumed. It reports
+// whether the loop should stop and whether the result has to be returned
+// to an outer loop or function as is
+func (rr *RuntimeResult) LoopSignal(label string) (stop bool, propagate bool) {
+	if rr.Error != nil || rr.FunReturnValue != nil {
+		return true, true
+	}
+	if !rr.BreakLoop && !rr.ContinueLoop {
+		return false, false
+	}
+	if rr.LoopLabel != "" && rr.LoopLabel != label {
+		return true, true
+	}
+
+	stop = rr.BreakLoop
+	rr.Reset()
+	return stop, false
+}
+
+// profileLoopName returns the name a loop has in profiles, or "" for nodes
+// that aren't loops
+func profileLoopName(n interface{}) string {
+	kind := ""
+	switch n.(type) {
+	case *ForNode:
+		kind = "for loop"
+	case *EachNode:
+		kind = "each loop"
+	case *WhileNode, *WhileLetNode, *DoWhileNode:
+		kind = "while loop"
+	case *LoopNode:
+		kind = "loop"
+	default:
+		return ""
+	}
+	if sp, _ := FirstPosition(n); sp != nil {
+		return fmt.Sprintf("<%v at line %v>", kind, sp.Line)
+	}
+	return "<" + kind + ">"
+}
+
+// DebugHook is called with every node before it's visited while a debugger
+// is attached, it can pause the program by not returning
+var DebugHook func(node interface{}, ctx *Context)
+
 func (i *Interpretor) Visit(n interface{}, ctx *Context) *RuntimeResult {
+	if DebugHook != nil {
+		DebugHook(n, ctx)
+	}
+	if ActiveCoverage != nil {
+		ActiveCoverage.Hit(n)
+	}
+	if ActiveProfile != nil {
+		if name := profileLoopName(n); name != "" {
+			ActiveProfile.Enter(name)
+			defer ActiveProfile.Exit()
+		}
+	}
+
 	if num, ok := n.(*NumberNode); ok {
 		return i.VisitNumberNode(num, ctx)
 	} else if str, ok := n.(*StringNode); ok {
@@ -107,6 +177,14 @@ func (i *Interpretor) Visit(n interface{}, ctx *Context) *RuntimeResult {
 		return i.VisitEachNode(each, ctx)
 	} else if while, ok := n.(*WhileNode); ok {
 		return i.VisitWhileNode(while, ctx)
+	} else if whileLet, ok := n.(*WhileLetNode); ok {
+		return i.VisitWhileLetNode(whileLet, ctx)
+	} else if loop, ok := n.(*LoopNode); ok {
+		return i.VisitLoopNode(loop, ctx)
+	} else if doWhile, ok := n.(*DoWhileNode); ok {
+		return i.VisitDoWhileNode(doWhile, ctx)
+	} else if yield, ok := n.(*YieldNode); ok {
+		return i.VisitYieldNode(yield, ctx)
 	} else if contin, ok := n.(*ContinueNode); ok {
 		return i.VisitContinueNode(contin, ctx)
 	} else if brk, ok := n.(*BreakNode); ok {
@@ -119,6 +197,20 @@ func (i *Interpretor) Visit(n interface{}, ctx *Context) *RuntimeResult {
 		return i.VisitElementAssignNode(assign, ctx)
 	} else if ret, ok := n.(*ReturnNode); ok {
 		return i.VisitReturnNode(ret, ctx)
+	} else if is, ok := n.(*IsNode); ok {
+		return i.VisitIsNode(is, ctx)
+	} else if let, ok := n.(*LetNode); ok {
+		return i.VisitLetNode(let, ctx)
+	} else if compound, ok := n.(*CompoundAssignNode); ok {
+		return i.VisitCompoundAssignNode(compound, ctx)
+	} else if destructure, ok := n.(*DestructureAssignNode); ok {
+		return i.VisitDestructureAssignNode(destructure, ctx)
+	} else if comp, ok := n.(*ComprehensionNode); ok {
+		return i.VisitComprehensionNode(comp, ctx)
+	} else if m, ok := n.(*MapNode); ok {
+		return i.VisitMapNode(m, ctx)
+	} else if match, ok := n.(*MatchNode); ok {
+		return i.VisitMatchNode(match, ctx)
 	} else {
 		panic("no visit method for this node")
 	}
@@ -178,97 +270,112 @@ func (i *Interpretor) VisitTernOpNode(t *TernOpNode, ctx *Context) *RuntimeResul
 func (i *Interpretor) VisitBinOpNode(b *BinOpNode, ctx *Context) *RuntimeResult {
 	rr := NewRuntimeResult()
 
-	l := rr.Register(i.Visit(b.Right, ctx))
+	// Short-circuit operators only evaluate the right side if the left one
+	// doesn't decide the result, and return the deciding operand as is
+	if b.Op.Value == "and" || b.Op.Value == "or" || b.Op.Value == "??" {
+		left := rr.Register(i.Visit(b.Left, ctx))
+		if rr.ShouldReturn() {
+			return rr
+		}
+
+		_, isNull := left.(*Null)
+		switch b.Op.Value {
+		case "and":
+			if !left.IsTrue() {
+				return rr.Success(left)
+			}
+		case "or":
+			if left.IsTrue() {
+				return rr.Success(left)
+			}
+		case "??":
+			if !isNull {
+				return rr.Success(left)
+			}
+		}
+
+		right := rr.Register(i.Visit(b.Right, ctx))
+		if rr.ShouldReturn() {
+			return rr
+		}
+		return rr.Success(right)
+	}
+
+	left := rr.Register(i.Visit(b.Left, ctx))
 	if rr.ShouldReturn() {
 		return rr
 	}
-	r := rr.Register(i.Visit(b.Left, ctx))
+	right := rr.Register(i.Visit(b.Right, ctx))
 	if rr.ShouldReturn() {
 		return rr
 	}
 
 	switch b.Op.Value {
-	case "+":
-		res, err := r.AddTo(l)
-		if err != nil {
-			return rr.Failure(err)
-		}
-		return rr.Success(res)
-	case "-":
-		res, err := r.SubBy(l)
-		if err != nil {
-			return rr.Failure(err)
-		}
-		return rr.Success(res)
-	case "*":
-		res, err := r.MulBy(l)
-		if err != nil {
-			return rr.Failure(err)
-		}
-		return rr.Success(res)
-	case "/":
-		res, err := r.DivBy(l)
-		if err != nil {
-			return rr.Failure(err)
-		}
-		return rr.Success(res)
-	case "%":
-		res, err := r.Mod(l)
-		if err != nil {
-			return rr.Failure(err)
-		}
-		return rr.Success(res)
-	case "^":
-		res, err := r.Pow(l)
+	case "+", "-", "*", "/", "%", "^":
+		res, err := ApplyArithOp(b.Op.Value.(string), left, right)
 		if err != nil {
 			return rr.Failure(err)
 		}
 		return rr.Success(res)
 	case "==":
-		return rr.Success(r.IsEqualTo(l))
+		return rr.Success(left.IsEqualTo(right))
 	case "!=":
-		return rr.Success(r.IsNotEqualTo(l))
+		return rr.Success(left.IsNotEqualTo(right))
 	case ">":
-		res, err := r.IsGreaterThan(l)
+		res, err := left.IsGreaterThan(right)
 		if err != nil {
 			return rr.Failure(err)
 		}
 		return rr.Success(res)
 	case ">=":
-		res, err := r.IsGreaterThanOrEqual(l)
+		res, err := left.IsGreaterThanOrEqual(right)
 		if err != nil {
 			return rr.Failure(err)
 		}
 		return rr.Success(res)
 	case "<":
-		res, err := r.IsLessThan(l)
+		res, err := left.IsLessThan(right)
 		if err != nil {
 			return rr.Failure(err)
 		}
 		return rr.Success(res)
 	case "<=":
-		res, err := r.IsLessThanOrEqual(l)
+		res, err := left.IsLessThanOrEqual(right)
 		if err != nil {
 			return rr.Failure(err)
 		}
 		return rr.Success(res)
-	case "and":
-		res, err := r.And(l)
-		if err != nil {
-			return rr.Failure(err)
+	case "..", "..<":
+		start, ok := left.(*Number)
+		end, ok2 := right.(*Number)
+		if !ok || !ok2 {
+			return rr.Failure(NewRuntimeError(
+				fmt.Sprintf("Expected numbers on both sides of '%v'", b.Op.Value), b.Op.StartPos, b.Op.EndPos))
 		}
-		return rr.Success(res)
-	case "or":
-		res, err := r.Or(l)
-		if err != nil {
-			return rr.Failure(err)
-		}
-		return rr.Success(res)
+		return rr.Success(NewRange(start.Value, end.Value, 1, b.Op.Value == ".."))
 	default:
 		return rr.Failure(NewInvalidSyntaxError("Unexpected operator", nil, nil))
 	}
 }
 
+func ApplyArithOp(op string, left, right Value) (Value, *Error) {
+	switch op {
+	case "+":
+		return left.AddTo(right)
+	case "-":
+		return left.SubBy(right)
+	case "*":
+		return left.MulBy(right)
+	case "/":
+		return left.DivBy(right)
+	case "%":
+		return left.Mod(right)
+	case "^":
+		return left.Pow(right)
+	}
+	return nil, NewInvalidSyntaxError("Unexpected operator", nil, nil)
+}
+
 func (i *Interpretor) VisitUnaryOpNode(u *UnaryOpNode, ctx *Context) *RuntimeResult {
 	rr := NewRuntimeResult()
 
@@ -299,6 +406,93 @@ func (i *Interpretor) VisitVarAssignNode(va *VarAssignNode, ctx *Context) *Runti
 	return rr.Success(ctx.SymbolTable.Set(va.NameToken.Value.(string), num))
 }
 
+func (i *Interpretor) VisitIsNode(is *IsNode, ctx *Context) *RuntimeResult {
+	rr := NewRuntimeResult()
+
+	val := rr.Register(i.Visit(is.Node, ctx))
+	if rr.ShouldReturn() {
+		return rr
+	}
+
+	if MatchesType(val, is.Type) {
+		return rr.Success(NewNumber(1))
+	}
+	return rr.Success(NewNumber(0))
+}
+
+func (i *Interpretor) VisitLetNode(l *LetNode, ctx *Context) *RuntimeResult {
+	rr := NewRuntimeResult()
+
+	name := l.NameToken.Value.(string)
+	val := rr.Register(i.Visit(l.Value, ctx))
+	if rr.ShouldReturn() {
+		return rr
+	}
+
+	if EnforceTypes {
+		err := CheckValueType(fmt.Sprintf("'%v'", name), val, l.Type, l.NameToken.StartPos, l.NameToken.EndPos)
+		if err != nil {
+			return rr.Failure(err)
+		}
+	}
+
+	return rr.Success(ctx.SymbolTable.Set(name, val))
+}
+
+func (i *Interpretor) VisitCompoundAssignNode(c *CompoundAssignNode, ctx *Context) *RuntimeResult {
+	rr := NewRuntimeResult()
+	op := c.Op.Value.(string)[:1]
+
+	if access, ok := c.Target.(*VarAccessNode); ok {
+		name := access.NameToken.Value.(string)
+		old := ctx.SymbolTable.Get(name)
+		if old == nil {
+			return rr.Failure(NewRuntimeError(
+				fmt.Sprintf("'%v' is not defined", name),
+				access.NameToken.StartPos, access.NameToken.EndPos))
+		}
+		val := rr.Register(i.Visit(c.Value, ctx))
+		if rr.ShouldReturn() {
+			return rr
+		}
+		res, err := ApplyArithOp(op, old, val)
+		if err != nil {
+			return rr.Failure(err)
+		}
+		return rr.Success(ctx.SymbolTable.Set(name, res))
+	}
+
+	if access, ok := c.Target.(*ElementAccessNode); ok {
+		list := rr.Register(i.Visit(access.Node, ctx))
+		if rr.ShouldReturn() {
+			return rr
+		}
+		index := rr.Register(i.Visit(access.Index, ctx))
+		if rr.ShouldReturn() {
+			return rr
+		}
+		old := rr.Register(i.ElementOf(list, index, ctx))
+		if rr.ShouldReturn() {
+			return rr
+		}
+		val := rr.Register(i.Visit(c.Value, ctx))
+		if rr.ShouldReturn() {
+			return rr
+		}
+		res, err := ApplyArithOp(op, old, val)
+		if err != nil {
+			return rr.Failure(err)
+		}
+		err = i.AssignElement(list, index, res, access.StartPos, access.EndPos)
+		if err != nil {
+			return rr.Failure(err)
+		}
+		return rr.Success(res)
+	}
+
+	return rr.Failure(NewInvalidSyntaxError("Invalid assignment target", c.Op.StartPos, c.Op.EndPos))
+}
+
 func (i *Interpretor) VisitVarAccessNode(va *VarAccessNode, ctx *Context) *RuntimeResult {
 	rr := NewRuntimeResult()
 
@@ -363,18 +557,99 @@ func (i *Interpretor) VisitWhileNode(w *WhileNode, ctx *Context) *RuntimeResult
 			break
 		}
 		rr.Register(i.Visit(w.Exp, ctx))
-		if rr.ShouldReturn() && !rr.BreakLoop && !rr.ContinueLoop {
+		stop, propagate := rr.LoopSignal(w.Label)
+		if propagate {
 			return rr
 		}
-		if rr.BreakLoop {
+		if stop {
+			return rr.Success(NewNull())
+		}
+	}
+
+	return i.VisitLoopElse(w.ElseCase, ctx)
+}
+
+func (i *Interpretor) VisitWhileLetNode(w *WhileLetNode, ctx *Context) *RuntimeResult {
+	rr := NewRuntimeResult()
+
+	for {
+		val := rr.Register(i.Visit(w.Value, ctx))
+		if rr.ShouldReturn() {
+			return rr
+		}
+		if _, isNull := val.(*Null); isNull {
 			break
 		}
-		if rr.ContinueLoop {
-			continue
+
+		err := i.Destructure(w.Pattern, val, ctx)
+		if err != nil {
+			return rr.Failure(err)
+		}
+
+		rr.Register(i.Visit(w.Body, ctx))
+		stop, propagate := rr.LoopSignal(w.Label)
+		if propagate {
+			return rr
+		}
+		if stop {
+			return rr.Success(NewNull())
 		}
 	}
 
-	return rr
+	return i.VisitLoopElse(w.ElseCase, ctx)
+}
+
+func (i *Interpretor) VisitLoopNode(l *LoopNode, ctx *Context) *RuntimeResult {
+	rr := NewRuntimeResult()
+
+	for {
+		rr.Register(i.Visit(l.Body, ctx))
+		stop, propagate := rr.LoopSignal(l.Label)
+		if propagate {
+			return rr
+		}
+		if stop {
+			return rr.Success(NewNull())
+		}
+	}
+}
+
+func (i *Interpretor) VisitDoWhileNode(d *DoWhileNode, ctx *Context) *RuntimeResult {
+	rr := NewRuntimeResult()
+
+	for {
+		rr.Register(i.Visit(d.Body, ctx))
+		stop, propagate := rr.LoopSignal(d.Label)
+		if propagate {
+			return rr
+		}
+		if stop {
+			return rr.Success(NewNull())
+		}
+
+		cond := rr.Register(i.Visit(d.Cond, ctx))
+		if rr.ShouldReturn() {
+			return rr
+		}
+		if !cond.IsTrue() {
+			return rr.Success(NewNull())
+		}
+	}
+}
+
+// VisitLoopElse runs the else block of a loop that finished without a break
+func (i *Interpretor) VisitLoopElse(elseCase interface{}, ctx *Context) *RuntimeResult {
+	rr := NewRuntimeResult()
+
+	if elseCase == nil {
+		return rr.Success(NewNull())
+	}
+
+	rr.Register(i.Visit(elseCase, ctx))
+	if rr.ShouldReturn() {
+		return rr
+	}
+	return rr.Success(NewNull())
 }
 
 func (i *Interpretor) VisitForNode(f *ForNode, ctx *Context) *RuntimeResult {
@@ -416,14 +691,12 @@ func (i *Interpretor) VisitForNode(f *ForNode, ctx *Context) *RuntimeResult {
 						ctx.SymbolTable.Set(varName, NewNumber(from))
 						from += by
 						rr.Register(i.Visit(f.Body, ctx))
-						if rr.ShouldReturn() && !rr.BreakLoop && !rr.ContinueLoop {
+						stop, propagate := rr.LoopSignal(f.Label)
+						if propagate {
 							return rr
 						}
-						if rr.BreakLoop {
-							break
-						}
-						if rr.ContinueLoop {
-							continue
+						if stop {
+							return rr.Success(NewNull())
 						}
 					} else {
 						ctx.SymbolTable.Del(varName)
@@ -431,7 +704,7 @@ func (i *Interpretor) VisitForNode(f *ForNode, ctx *Context) *RuntimeResult {
 					}
 				}
 
-				return rr
+				return i.VisitLoopElse(f.ElseCase, ctx)
 			}
 			return rr.Failure(NewRuntimeError("Expected a number after 'by'", nil, nil))
 		}
@@ -448,45 +721,99 @@ func (i *Interpretor) VisitEachNode(e *EachNode, ctx *Context) *RuntimeResult {
 	if rr.ShouldReturn() {
 		return rr
 	}
-	if list, ok := listVal.(*List); ok {
-		itemName := e.ItemName.Value.(string)
 
-		for _, item := range list.Elements {
-			ctx.SymbolTable.Set(itemName, item.(Value))
+	it, err := listVal.Iter()
+	if err != nil {
+		return rr.Failure(NewRuntimeError(
+			fmt.Sprintf("Expected an iterable value in 'each', got %v", listVal), err.StartPos, err.EndPos))
+	}
 
-			rr.Register(i.Visit(e.Body, ctx))
+	itemNames := PatternNames(e.ItemPattern)
+	if e.ItemName != nil {
+		itemNames = []string{e.ItemName.Value.(string)}
+	}
 
-			if rr.ShouldReturn() && !rr.BreakLoop && !rr.ContinueLoop {
-				return rr
-			}
-			if rr.BreakLoop {
-				break
-			}
-			if rr.ContinueLoop {
-				continue
+	broke := false
+	for index := 0; ; index++ {
+		item, ok, err := it.Next()
+		if err != nil {
+			return rr.Failure(err)
+		}
+		if !ok {
+			break
+		}
+
+		if e.IndexName != nil {
+			ctx.SymbolTable.Set(e.IndexName.Value.(string), NewNumber(float64(index)))
+		}
+
+		if e.ItemPattern != nil {
+			err := i.Destructure(e.ItemPattern, item, ctx)
+			if err != nil {
+				return rr.Failure(err)
 			}
+		} else {
+			ctx.SymbolTable.Set(itemNames[0], item)
 		}
+
+		rr.Register(i.Visit(e.Body, ctx))
+
+		stop, propagate := rr.LoopSignal(e.Label)
+		if propagate {
+			return rr
+		}
+		if stop {
+			broke = true
+			break
+		}
+	}
+	for _, itemName := range itemNames {
 		ctx.SymbolTable.Del(itemName)
-		return rr
 	}
+	if e.IndexName != nil {
+		ctx.SymbolTable.Del(e.IndexName.Value.(string))
+	}
+	if broke {
+		return rr.Success(NewNull())
+	}
+	return i.VisitLoopElse(e.ElseCase, ctx)
+}
 
-	return rr.Failure(NewRuntimeError("Expected a list in 'each'", nil, nil))
+func (i *Interpretor) VisitYieldNode(y *YieldNode, ctx *Context) *RuntimeResult {
+	rr := NewRuntimeResult()
+
+	if ctx.Yield == nil {
+		return rr.Failure(NewRuntimeError("'yield' can only be used inside a generator function", y.Token.StartPos, y.Token.EndPos))
+	}
+
+	var val Value = NewNull()
+	if y.Value != nil {
+		val = rr.Register(i.Visit(y.Value, ctx))
+		if rr.ShouldReturn() {
+			return rr
+		}
+	}
+
+	ctx.Yield(val)
+
+	return rr.Success(NewNull())
 }
 
 func (i *Interpretor) VisitContinueNode(r *ContinueNode, ctx *Context) *RuntimeResult {
 	rr := NewRuntimeResult()
-	return rr.SuccessContinue()
+	return rr.SuccessContinue(r.Label)
 }
 
 func (i *Interpretor) VisitBreakNode(r *BreakNode, ctx *Context) *RuntimeResult {
 	rr := NewRuntimeResult()
-	return rr.SuccessBreak()
+	return rr.SuccessBreak(r.Label)
 }
 
 func (i *Interpretor) VisitFunDefNode(f *FunDefNode, ctx *Context) *RuntimeResult {
 	rr := NewRuntimeResult()
 
-	fun := NewFunction(f.Name, f.ArgNames, f.Body, f.ReturnBody)
+	fun := NewFunction(f.Name, f.Params, f.Body, f.ReturnBody, f.IsGenerator)
+	fun.(*Function).ReturnType = f.ReturnType
 
 	if f.Name != "" {
 		ctx.SymbolTable.Set(f.Name, fun)
@@ -498,13 +825,41 @@ func (i *Interpretor) VisitFunDefNode(f *FunDefNode, ctx *Context) *RuntimeResul
 func (i *Interpretor) VisitFunCallNode(f *FunCallNode, ctx *Context) *RuntimeResult {
 	rr := NewRuntimeResult()
 
-	fun := rr.Register(i.Visit(f.Name, ctx))
+	res := i.Visit(f.Name, ctx)
+	if res.SkipChain && f.Chained {
+		return res
+	}
+	fun := rr.Register(res)
 	if rr.ShouldReturn() {
 		return rr
 	}
+	if _, isNull := fun.(*Null); isNull && f.Optional {
+		rr.Success(fun).SkipChain = true
+		return rr
+	}
 	args := []interface{}{}
 
 	for _, val := range f.Args {
+		if spread, ok := val.(*SpreadNode); ok {
+			item := rr.Register(i.Visit(spread.Node, ctx))
+			if rr.ShouldReturn() {
+				return rr
+			}
+			list, ok := item.(*List)
+			if !ok {
+				return rr.Failure(NewRuntimeError(fmt.Sprintf("Expected a list to spread, got %v", item), nil, nil))
+			}
+			args = append(args, list.Elements...)
+			continue
+		}
+		if kw, ok := val.(*KeywordArgNode); ok {
+			item := rr.Register(i.Visit(kw.Value, ctx))
+			if rr.ShouldReturn() {
+				return rr
+			}
+			args = append(args, &KeywordArg{Name: kw.NameToken.Value.(string), Value: item})
+			continue
+		}
 		item := rr.Register(i.Visit(val, ctx))
 		if rr.ShouldReturn() {
 			return rr
@@ -513,6 +868,10 @@ func (i *Interpretor) VisitFunCallNode(f *FunCallNode, ctx *Context) *RuntimeRes
 	}
 
 	val := rr.Register(fun.Call(args, ctx))
+	if rr.Error != nil && rr.Error.StartPos == nil {
+		// Builtins don't know where they're called from
+		rr.Error.StartPos, rr.Error.EndPos = FirstPosition(f)
+	}
 	if rr.ShouldReturn() {
 		return rr
 	}
@@ -551,60 +910,424 @@ func (i *Interpretor) VisitListNode(f *ListNode, ctx *Context) *RuntimeResult {
 
 func (i *Interpretor) VisitElementAccessNode(a *ElementAccessNode, ctx *Context) *RuntimeResult {
 	rr := NewRuntimeResult()
-	list := rr.Register(i.Visit(a.Node, ctx))
+	res := i.Visit(a.Node, ctx)
+	if res.SkipChain && a.Chained {
+		return res
+	}
+	list := rr.Register(res)
 	if rr.ShouldReturn() {
 		return rr
 	}
+	if _, isNull := list.(*Null); isNull && a.Optional {
+		rr.Success(list).SkipChain = true
+		return rr
+	}
 	index := rr.Register(i.Visit(a.Index, ctx))
 	if rr.ShouldReturn() {
 		return rr
 	}
+	if a.To == nil {
+		// The values report where they were created, the error belongs where
+		// they're accessed
+		res := rr.Register(i.ElementOf(list, index, ctx))
+		if rr.Error != nil {
+			return rr.Failure(NewRuntimeError(rr.Error.Details, a.StartPos, a.EndPos))
+		}
+		if rr.ShouldReturn() {
+			return rr
+		}
+		return rr.Success(res)
+	}
 	if idx, ok := index.(*Number); ok {
-		if a.To != nil {
-			to := rr.Register(i.Visit(a.To, ctx))
+		to := rr.Register(i.Visit(a.To, ctx))
+		if rr.ShouldReturn() {
+			return rr
+		}
+
+		if t, ok := to.(*Number); ok {
+			res := rr.Register(list.AccessElement(int(idx.Value), int(t.Value), ctx))
+			if rr.Error != nil {
+				return rr.Failure(NewRuntimeError(rr.Error.Details, a.StartPos, a.EndPos))
+			}
 			if rr.ShouldReturn() {
 				return rr
 			}
-		
-			if t, ok := to.(*Number); ok {
-				res := rr.Register(list.AccessElement(int(idx.Value), int(t.Value), ctx))
-				if rr.ShouldReturn() {
-					return rr
-				}
-				return rr.Success(res)
+			return rr.Success(res)
+		}
+		return rr.Failure(NewRuntimeError("Expected a number for the to-index", a.StartPos, a.EndPos))
+	}
+	return rr.Failure(NewRuntimeError("Expected a number for the index", a.StartPos, a.EndPos))
+}
+
+func (i *Interpretor) ElementOf(list, index Value, ctx *Context) *RuntimeResult {
+	rr := NewRuntimeResult()
+	if m, ok := list.(*Map); ok {
+		if key, ok := index.(*String); ok {
+			if val, ok := m.Get(key.Value); ok {
+				return rr.Success(val)
 			}
-			return rr.Failure(NewRuntimeError("Expected a number for the to-index", nil, nil))
+			return rr.Success(NewNull())
 		}
-		res := rr.Register(list.AccessElement(int(idx.Value), nil, ctx))
-		if rr.ShouldReturn() {
-			return rr
+		return rr.Failure(NewRuntimeError("Expected a string for the map key", nil, nil))
+	}
+	if idx, ok := index.(*Number); ok {
+		return list.AccessElement(int(idx.Value), nil, ctx)
+	}
+	if rng, ok := index.(*Range); ok {
+		if rng.Step != 1 {
+			return rr.Failure(NewRuntimeError("Can only slice using a range with a step of 1", nil, nil))
 		}
-		return rr.Success(res)
+		return list.AccessElement(int(rng.Start), int(rng.Start) + rng.Len(), ctx)
+	}
+	if key, ok := index.(*String); ok {
+		return rr.Failure(NewRuntimeError(fmt.Sprintf("Can't access the field '%v' of a %v", key.Value, TypeName(list)), nil, nil))
 	}
-	return rr.Failure(NewRuntimeError("Expected a number for the index", nil, nil))
+	return rr.Failure(NewRuntimeError("Expected a number or a range for the index", nil, nil))
 }
 
 func (i *Interpretor) VisitElementAssignNode(a *ElementAssignNode, ctx *Context) *RuntimeResult {
 	rr := NewRuntimeResult()
-	list := ctx.SymbolTable.Get(a.NameToken.Value.(string))
+	list := rr.Register(i.Visit(a.Node, ctx))
+	if rr.ShouldReturn() {
+		return rr
+	}
+	index := rr.Register(i.Visit(a.Index, ctx))
+	if rr.ShouldReturn() {
+		return rr
+	}
+	val := rr.Register(i.Visit(a.Value, ctx))
+	if rr.ShouldReturn() {
+		return rr
+	}
+	err := i.AssignElement(list, index, val, a.StartPos, a.EndPos)
+	if err != nil {
+		return rr.Failure(err)
+	}
+	return rr.Success(val)
+}
+
+func (i *Interpretor) AssignElement(list, index, val Value, sp, ep *Position) *Error {
+	if m, ok := list.(*Map); ok {
+		if key, ok := index.(*String); ok {
+			m.Set(key.Value, val)
+			return nil
+		}
+		return NewRuntimeError(fmt.Sprintf("Expected a string for the map key, got %v", index), sp, ep)
+	}
 	if l, ok := list.(*List); ok {
-		index := rr.Register(i.Visit(a.Index, ctx))
-		if rr.ShouldReturn() {
-			return rr
+		if idx, ok := index.(*Number); ok {
+			at := int(idx.Value)
+			if at < 0 || at >= len(l.Elements) {
+				return NewRuntimeError(
+					fmt.Sprintf("Index out of range (%v) with length of %v", at, len(l.Elements)), sp, ep)
+			}
+			l.Elements[at] = val
+			return nil
+		}
+		return NewRuntimeError(fmt.Sprintf("Expected a number for the index, got %v", index), sp, ep)
+	}
+	return NewRuntimeError(fmt.Sprintf("Can't assign an element of %v, expected a list or a map", list), sp, ep)
+}
+
+func (i *Interpretor) VisitDestructureAssignNode(d *DestructureAssignNode, ctx *Context) *RuntimeResult {
+	rr := NewRuntimeResult()
+
+	val := rr.Register(i.Visit(d.Value, ctx))
+	if rr.ShouldReturn() {
+		return rr
+	}
+
+	err := i.Destructure(d.Pattern, val, ctx)
+	if err != nil {
+		return rr.Failure(err)
+	}
+
+	return rr.Success(val)
+}
+
+func (i *Interpretor) Destructure(pattern interface{}, val Value, ctx *Context) *Error {
+	switch pt := pattern.(type) {
+	case *WildcardPatternNode:
+		return nil
+	case *BindPatternNode:
+		ctx.SymbolTable.Set(pt.NameToken.Value.(string), val)
+		return nil
+	case *ElementAccessNode:
+		list := i.Visit(pt.Node, ctx)
+		if list.Error != nil {
+			return list.Error
+		}
+		index := i.Visit(pt.Index, ctx)
+		if index.Error != nil {
+			return index.Error
+		}
+		return i.AssignElement(list.Value, index.Value, val, pt.StartPos, pt.EndPos)
+	case *ListPatternNode:
+		list, ok := val.(*List)
+		if !ok {
+			return NewRuntimeError(fmt.Sprintf("Expected a list to destructure into %v, got %v", pt, val), nil, nil)
+		}
+		if len(list.Elements) < len(pt.Elements) || (pt.Rest == nil && len(list.Elements) != len(pt.Elements)) {
+			return NewRuntimeError(
+				fmt.Sprintf("Expected %v elements to destructure into %v, got %v", len(pt.Elements), pt, len(list.Elements)),
+				nil, nil)
+		}
+		for index, el := range pt.Elements {
+			err := i.Destructure(el, list.Elements[index].(Value), ctx)
+			if err != nil {
+				return err
+			}
+		}
+		if pt.Rest != nil && pt.Rest.Value != "_" {
+			rest := append([]interface{}{}, list.Elements[len(pt.Elements):]...)
+			ctx.SymbolTable.Set(pt.Rest.Value.(string), NewList(rest))
 		}
-		val := rr.Register(i.Visit(a.Value, ctx))
+		return nil
+	case *MapPatternNode:
+		m, ok := val.(*Map)
+		if !ok {
+			return NewRuntimeError(fmt.Sprintf("Expected a map to destructure into %v, got %v", pt, val), nil, nil)
+		}
+		for index, key := range pt.Keys {
+			item, ok := m.Get(key)
+			if !ok {
+				item = NewNull()
+			}
+			err := i.Destructure(pt.Values[index], item, ctx)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	return NewRuntimeError("Invalid destructuring target", nil, nil)
+}
+
+func (i *Interpretor) VisitMapNode(m *MapNode, ctx *Context) *RuntimeResult {
+	rr := NewRuntimeResult()
+
+	res := NewMap([]string{}, map[string]Value{})
+
+	for index, key := range m.Keys {
+		val := rr.Register(i.Visit(m.Values[index], ctx))
 		if rr.ShouldReturn() {
 			return rr
 		}
-		if idx, ok := index.(*Number); ok {
-			l.Elements[int(idx.GetVal().(float64))] = val
+		res.Set(key, val)
+	}
+
+	return rr.Success(res)
+}
+
+func (i *Interpretor) VisitComprehensionNode(c *ComprehensionNode, ctx *Context) *RuntimeResult {
+	rr := NewRuntimeResult()
+
+	// The comprehension gets its own scope so its names don't leak out
+	compCtx := NewContext("<comprehension>")
+	compCtx.Parent = ctx
+	compCtx.SymbolTable = &SymbolTable{Symbols: map[string]Value{}, Parent: ctx.SymbolTable}
+
+	elements := []interface{}{}
+	m := NewMap([]string{}, map[string]Value{})
+
+	var run func(clause int) *Error
+	run = func(clause int) *Error {
+		if clause == len(c.Clauses) {
+			if c.Key == nil {
+				val := rr.Register(i.Visit(c.Value, compCtx))
+				if rr.Error != nil {
+					return rr.Error
+				}
+				elements = append(elements, val)
+				return nil
+			}
+
+			// The key is evaluated before the value, like it's written
+			key := rr.Register(i.Visit(c.Key, compCtx))
+			if rr.Error != nil {
+				return rr.Error
+			}
+			k, ok := key.(*String)
+			if !ok {
+				return NewRuntimeError(fmt.Sprintf("Expected a string for the map key, got %v", key), c.StartPos, c.EndPos)
+			}
+			val := rr.Register(i.Visit(c.Value, compCtx))
+			if rr.Error != nil {
+				return rr.Error
+			}
+			m.Set(k.Value, val)
+			return nil
+		}
+
+		each, ok := c.Clauses[clause].(*EachClauseNode)
+		if !ok {
+			cond := rr.Register(i.Visit(c.Clauses[clause], compCtx))
+			if rr.Error != nil {
+				return rr.Error
+			}
+			if cond.IsTrue() {
+				return run(clause + 1)
+			}
+			return nil
+		}
+
+		iterable := rr.Register(i.Visit(each.List, compCtx))
+		if rr.Error != nil {
+			return rr.Error
+		}
+		it, err := iterable.Iter()
+		if err != nil {
+			return NewRuntimeError(
+				fmt.Sprintf("Expected an iterable value in 'each', got %v", iterable), c.StartPos, c.EndPos)
+		}
+
+		for index := 0; ; index++ {
+			item, ok, err := it.Next()
+			if err != nil {
+				return err
+			}
+			if !ok {
+				return nil
+			}
+
+			if each.IndexName != nil {
+				compCtx.SymbolTable.Set(each.IndexName.Value.(string), NewNumber(float64(index)))
+			}
+			err = i.Destructure(each.ItemPattern, item, compCtx)
+			if err != nil {
+				return err
+			}
+
+			err = run(clause + 1)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	err := run(0)
+	if err != nil {
+		return rr.Failure(err)
+	}
+
+	if c.Key != nil {
+		return rr.Success(m)
+	}
+	return rr.Success(NewList(elements))
+}
+
+func (i *Interpretor) VisitMatchNode(m *MatchNode, ctx *Context) *RuntimeResult {
+	rr := NewRuntimeResult()
+
+	val := rr.Register(i.Visit(m.Value, ctx))
+	if rr.ShouldReturn() {
+		return rr
+	}
+
+	for _, cs := range m.Cases {
+		binds := map[string]Value{}
+
+		matched, err := i.MatchPattern(cs.Pattern, val, ctx, binds)
+		if err != nil {
+			return rr.Failure(err)
+		}
+		if !matched {
+			continue
+		}
+
+		// The bindings only live for the case, the names they shadow get back
+		// their values however the case ends
+		prev := map[string]Value{}
+		for name, bound := range binds {
+			prev[name] = ctx.SymbolTable.Symbols[name]
+			ctx.SymbolTable.Set(name, bound)
+		}
+		restore := func() {
+			for name, old := range prev {
+				if old == nil {
+					ctx.SymbolTable.Del(name)
+				} else {
+					ctx.SymbolTable.Set(name, old)
+				}
+			}
+		}
+
+		if cs.Guard != nil {
+			guard := rr.Register(i.Visit(cs.Guard, ctx))
 			if rr.ShouldReturn() {
+				restore()
 				return rr
 			}
-			return rr.Success(val)
+
+			if !guard.IsTrue() {
+				restore()
+				continue
+			}
 		}
-		return rr.Failure(NewRuntimeError("Expected a number for the index", nil, nil))
+
+		res := rr.Register(i.Visit(cs.Body, ctx))
+		restore()
+		if rr.ShouldReturn() {
+			return rr
+		}
+		return rr.Success(res)
 	}
-	return rr.Failure(NewRuntimeError("Expected a list to assign it's element value",
-		a.NameToken.StartPos, a.NameToken.EndPos))
+
+	return rr.Failure(NewRuntimeError(
+		fmt.Sprintf("Non-exhaustive match, no pattern matched the value %v", val),
+		m.Token.StartPos, m.Token.EndPos))
+}
+
+func (i *Interpretor) MatchPattern(pattern interface{}, val Value, ctx *Context, binds map[string]Value) (bool, *Error) {
+	switch pt := pattern.(type) {
+	case *WildcardPatternNode:
+		return true, nil
+	case *BindPatternNode:
+		binds[pt.NameToken.Value.(string)] = val
+		return true, nil
+	case *ValuePatternNode:
+		res := i.Visit(pt.Node, ctx)
+		if res.Error != nil {
+			return false, res.Error
+		}
+		return res.Value.IsEqualTo(val).IsTrue(), nil
+	case *ListPatternNode:
+		list, ok := val.(*List)
+		if !ok {
+			return false, nil
+		}
+		if len(list.Elements) < len(pt.Elements) || (pt.Rest == nil && len(list.Elements) != len(pt.Elements)) {
+			return false, nil
+		}
+		for index, el := range pt.Elements {
+			matched, err := i.MatchPattern(el, list.Elements[index].(Value), ctx, binds)
+			if err != nil || !matched {
+				return false, err
+			}
+		}
+		if pt.Rest != nil && pt.Rest.Value != "_" {
+			rest := append([]interface{}{}, list.Elements[len(pt.Elements):]...)
+			binds[pt.Rest.Value.(string)] = NewList(rest)
+		}
+		return true, nil
+	case *MapPatternNode:
+		m, ok := val.(*Map)
+		if !ok {
+			return false, nil
+		}
+		for index, key := range pt.Keys {
+			item, ok := m.Get(key)
+			if !ok {
+				return false, nil
+			}
+			matched, err := i.MatchPattern(pt.Values[index], item, ctx, binds)
+			if err != nil || !matched {
+				return false, err
+			}
+		}
+		return true, nil
+	}
+
+	return false, NewRuntimeError("Invalid pattern", nil, nil)
 }
@@ -0,0 +1,212 @@
+package main
+
+import "runtime"
+
+type Iterator struct {
+	Name string
+	NextFunc func() (Value, bool, *Error)
+	// CloseFunc releases what the iterator holds when it's dropped before it
+	// ends, like the goroutine of a generator
+	CloseFunc func()
+	closed bool
+	StartPos, EndPos *Position
+}
+
+func NewIterator(n string, next func() (Value, bool, *Error)) *Iterator {
+	it := &Iterator{
+		Name: n,
+		NextFunc: next,
+	}
+
+	return it
+}
+
+type generatorMessage struct {
+	Value Value
+	Error *Error
+	Done bool
+}
+
+func NewGenerator(f *Function, body interface{}, ctx *Context) *Iterator {
+	yields := make(chan generatorMessage)
+	resume := make(chan bool)
+	// closed stops the body at its next yield when the generator is closed
+	closed := make(chan bool)
+	started := false
+	done := false
+	// The frames of the body while it's paused at a yield
+	var frames []*profileNode
+
+	ctx.Yield = func(val Value) {
+		select {
+		case yields <- generatorMessage{Value: val}:
+		case <-closed:
+			runtime.Goexit()
+		}
+		select {
+		case <-resume:
+		case <-closed:
+			runtime.Goexit()
+		}
+	}
+
+	run := func() {
+		<-resume
+		i := NewInterpretor()
+		res := i.Visit(body, ctx)
+		select {
+		case yields <- generatorMessage{Error: res.Error, Done: true}:
+		case <-closed:
+		}
+	}
+
+	it := NewIterator(f.Name, func() (Value, bool, *Error) {
+		if done {
+			return nil, false, nil
+		}
+		if !started {
+			started = true
+			go run()
+		}
+
+		depth := 0
+		if ActiveProfile != nil {
+			if frames == nil {
+				frames = []*profileNode{ActiveProfile.Frame(f.Name)}
+			}
+			depth = ActiveProfile.Resume(frames)
+		}
+		resume <- true
+		msg := <-yields
+		if ActiveProfile != nil {
+			frames = ActiveProfile.Suspend(depth)
+		}
+
+		if msg.Done {
+			done = true
+			return nil, false, msg.Error
+		}
+		return msg.Value, true, nil
+	})
+	it.CloseFunc = func() {
+		if started && !done {
+			close(closed)
+		}
+		done = true
+	}
+	// A generator that's dropped before it ends, like one that take() or a
+	// break stopped reading, would keep its goroutine waiting at a yield
+	// forever, so it's closed once nothing can read it anymore
+	runtime.SetFinalizer(it, (*Iterator).Close)
+	return it
+}
+
+func (it *Iterator) Next() (Value, bool, *Error) {
+	if it.closed {
+		return nil, false, nil
+	}
+	return it.NextFunc()
+}
+
+// Close stops the iterator before it ends, Next returns nothing after it
+func (it *Iterator) Close() {
+	if it.closed {
+		return
+	}
+	it.closed = true
+	if it.CloseFunc != nil {
+		it.CloseFunc()
+	}
+}
+
+func (it *Iterator) String() string {
+	return "<iterator " + it.Name + ">"
+}
+
+func (it *Iterator) SetPos(sp, ep *Position) Value {
+	it.StartPos = sp
+	it.EndPos = ep
+	if ep == nil {
+		endPos := *sp
+		endPos.Advance("")
+		it.EndPos = &endPos
+	}
+	return it
+}
+
+func (it *Iterator) AddTo(other interface{}) (Value, *Error) {
+	return nil, NewInvalidSyntaxError("Invalid '+' operation on an iterator", it.StartPos, it.EndPos)
+}
+
+func (it *Iterator) SubBy(other interface{}) (Value, *Error) {
+	return nil, NewInvalidSyntaxError("Invalid '-' operation on an iterator", it.StartPos, it.EndPos)
+}
+
+func (it *Iterator) MulBy(other interface{}) (Value, *Error) {
+	return nil, NewInvalidSyntaxError("Invalid '*' operation on an iterator", it.StartPos, it.EndPos)
+}
+
+func (it *Iterator) DivBy(other interface{}) (Value, *Error) {
+	return nil, NewInvalidSyntaxError("Invalid '/' operation on an iterator", it.StartPos, it.EndPos)
+}
+
+func (it *Iterator) Mod(other interface{}) (Value, *Error) {
+	return nil, NewInvalidSyntaxError("Invalid '%' operation on an iterator", it.StartPos, it.EndPos)
+}
+
+func (it *Iterator) Pow(other interface{}) (Value, *Error) {
+	return nil, NewInvalidSyntaxError("Invalid '^' operation on an iterator", it.StartPos, it.EndPos)
+}
+
+func (it *Iterator) IsEqualTo(other interface{}) Value {
+	if o, ok := other.(*Iterator); ok && o == it {
+		return NewNumber(1)
+	}
+	return NewNumber(0)
+}
+
+func (it *Iterator) IsNotEqualTo(other interface{}) Value {
+	return it.IsEqualTo(other).Not()
+}
+
+func (it *Iterator) IsGreaterThan(other interface{}) (Value, *Error) {
+	return nil, NewInvalidSyntaxError("Can't compare iterators", it.StartPos, it.EndPos)
+}
+
+func (it *Iterator) IsGreaterThanOrEqual(other interface{}) (Value, *Error) {
+	return nil, NewRuntimeError("Can't compare iterators", it.StartPos, nil)
+}
+
+func (it *Iterator) IsLessThan(other interface{}) (Value, *Error) {
+	return nil, NewRuntimeError("Can't compare iterators", it.StartPos, nil)
+}
+
+func (it *Iterator) IsLessThanOrEqual(other interface{}) (Value, *Error) {
+	return nil, NewRuntimeError("Can't compare iterators", it.StartPos, nil)
+}
+
+func (it *Iterator) Not() Value {
+	return NewNumber(0)
+}
+
+func (it *Iterator) IsTrue() bool {
+	return true
+}
+
+func (it *Iterator) GetVal() interface{} {
+	return nil
+}
+
+func (it *Iterator) Call(args []interface{}, ctx *Context) *RuntimeResult {
+	rr := NewRuntimeResult()
+	return rr.Failure(NewRuntimeError("Can't call an iterator", it.StartPos, it.EndPos))
+}
+
+func (it *Iterator) AccessElement(index int, to interface{}, ctx *Context) *RuntimeResult {
+	rr := NewRuntimeResult()
+	return rr.Failure(NewRuntimeError("Can't access element from an iterator", it.StartPos, it.EndPos))
+}
+
+func (it *Iterator) Iter() (*Iterator, *Error) {
+	return it, nil
+}
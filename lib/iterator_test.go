@@ -0,0 +1,104 @@
+package main
+
+import (
+	"runtime"
+	"testing"
+	"time"
+)
+
+// runProgram runs a program in a fresh global scope and returns its error
+func runProgram(t *testing.T, program string) *Error {
+	t.Helper()
+	ast, err := Parse("<test>", program)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := NewContext("<root>")
+	ctx.SymbolTable = NewSymbolTable()
+	return NewInterpretor().Visit(ast, ctx).Error
+}
+
+// waitGoroutines collects the dropped generators until at most max
+// goroutines are left, it returns how many there are
+func waitGoroutines(max int) int {
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		runtime.GC()
+		n := runtime.NumGoroutine()
+		if n <= max || time.Now().After(deadline) {
+			return n
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestDroppedGeneratorsExit(t *testing.T) {
+	const naturals = `
+fun naturals() {
+  i = 1
+  while true {
+    yield i
+    i += 1
+  }
+}
+`
+	for _, c := range []struct {
+		Name, Program string
+		Runs int
+		Fails bool
+	}{
+		{"take", naturals + `
+each 1..200 as _ {
+  list(take(naturals(), 2))
+}
+`, 1, false},
+		{"break", naturals + `
+each 1..200 as _ {
+  each naturals() as n {
+    if n == 3 { break }
+  }
+}
+`, 1, false},
+		{"error", naturals + `
+each naturals() as n {
+  n[0][0] = 1
+}
+`, 200, true},
+	} {
+		t.Run(c.Name, func(t *testing.T) {
+			runtime.GC()
+			before := runtime.NumGoroutine()
+			for i := 0; i < c.Runs; i++ {
+				if err := runProgram(t, c.Program); (err != nil) != c.Fails {
+					t.Fatalf("unexpected result %v", err)
+				}
+			}
+			if after := waitGoroutines(before); after > before {
+				t.Errorf("%v goroutines before the generators ran and %v after", before, after)
+			}
+		})
+	}
+}
+
+func TestClosedGeneratorStops(t *testing.T) {
+	ast, err := Parse("<test>", "fun count() {\n  yield 1\n  yield 2\n}\ncount()")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := NewContext("<root>")
+	ctx.SymbolTable = NewSymbolTable()
+	res := NewInterpretor().Visit(ast, ctx)
+	if res.Error != nil {
+		t.Fatal(res.Error)
+	}
+	values := res.Value.GetVal().([]interface{})
+	it := values[len(values) - 1].(*Iterator)
+
+	if val, ok, err := it.Next(); err != nil || !ok || val.(*Number).Value != 1 {
+		t.Fatalf("first value is %v, %v, %v", val, ok, err)
+	}
+	it.Close()
+	if val, ok, err := it.Next(); err != nil || ok {
+		t.Errorf("closed generator gave %v, %v, %v", val, ok, err)
+	}
+}
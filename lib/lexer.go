@@ -9,13 +9,17 @@ const Digits = "0123456789"
 const Letters = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ"
 const IdAllowedChars = Letters + Digits + "_"
 
-var Keywords = [15]string{"and", "or", "not", "if", "else", "elif", "while", "for", "by", "fun", "return", "break", "continue", "each", "as"}
+var Keywords = [21]string{"and", "or", "not", "if", "else", "elif", "while", "for", "by", "fun", "return", "break", "continue", "each", "as", "match", "yield", "loop", "do", "let", "is"}
 
-const SimpleOps = "+-*/%^(){}?:,[]"
+const SimpleOps = "(){}:,[]"
+const ArithOps = "+-*/%^"
 
 type Lexer struct {
 	CurrChar, Text,	FileName,	FileText string
 	Pos *Position
+	// KeepComments makes comment tokens instead of skipping comments, the
+	// parser doesn't expect them so it's only used by the formatter
+	KeepComments bool
 }
 
 func NewLexer(txt, fn, ftxt string) *Lexer {
@@ -40,6 +44,13 @@ func (l *Lexer) Advance() {
 	}
 }
 
+func (l *Lexer) Peek() string {
+	if len(l.Text) > l.Pos.Index + 1 {
+		return l.Text[l.Pos.Index + 1:l.Pos.Index + 2]
+	}
+	return ""
+}
+
 func (l *Lexer) MakeId() *Token {
 	idStr := ""
 	startPos := *l.Pos
@@ -66,7 +77,7 @@ func (l *Lexer) MakeNumber() *Token {
 
 	for l.CurrChar != "" && strings.Contains(Digits + ".", l.CurrChar) {
 		if l.CurrChar == "." {
-			if hasDot {
+			if hasDot || l.Peek() == "." {
 				break
 			}
 			hasDot = true
@@ -114,7 +125,9 @@ func (l *Lexer) MakeString() (*Token, *Error) {
 	}
 
 	if l.CurrChar != "\"" {
-		return nil, NewInvalidSyntaxError("Expected '\"'", &startPos, l.Pos)
+		err := NewInvalidSyntaxError("Expected '\"'", &startPos, l.Pos)
+		err.Incomplete = true
+		return nil, err
 	}
 
 	l.Advance()
@@ -124,12 +137,25 @@ func (l *Lexer) MakeString() (*Token, *Error) {
 
 func (l *Lexer) SkipComment() {
 	l.Advance()
-	for l.CurrChar != "\n" {
+	for l.CurrChar != "\n" && l.CurrChar != "" {
 		l.Advance()
 	}
 	l.Advance()
 }
 
+func (l *Lexer) MakeComment() *Token {
+	startPos := *l.Pos
+	comment := ""
+
+	for l.CurrChar != "\n" && l.CurrChar != "" {
+		comment += l.CurrChar
+		l.Advance()
+	}
+
+	endPos := *l.Pos
+	return NewToken(TTComment, strings.TrimRight(comment, " \t\r"), &startPos, &endPos)
+}
+
 func (l *Lexer) MakeNotEquals() (*Token, *Error) {
 	startPos := *l.Pos
 
@@ -153,9 +179,79 @@ func (l *Lexer) MakeEquals() *Token {
 		return NewToken(TTOp, "==", &startPos, l.Pos)
 	}
 
+	if l.CurrChar == ">" {
+		l.Advance()
+		return NewToken(TTOp, "=>", &startPos, l.Pos)
+	}
+
 	return NewToken(TTOp, "=", &startPos, l.Pos)
 }
 
+func (l *Lexer) MakeArithOp() *Token {
+	startPos := *l.Pos
+	op := l.CurrChar
+
+	l.Advance()
+
+	if l.CurrChar == "=" {
+		l.Advance()
+		endPos := *l.Pos
+		return NewToken(TTOp, op + "=", &startPos, &endPos)
+	}
+
+	if op == "-" && l.CurrChar == ">" {
+		l.Advance()
+		endPos := *l.Pos
+		return NewToken(TTOp, "->", &startPos, &endPos)
+	}
+
+	// '++' and '--' are always one token, the parser splits them when
+	// they're not after a statement like in `3--1`
+	if (op == "+" || op == "-") && l.CurrChar == op {
+		l.Advance()
+		endPos := *l.Pos
+		return NewToken(TTOp, op + op, &startPos, &endPos)
+	}
+
+	return NewToken(TTOp, op, &startPos, nil)
+}
+
+func (l *Lexer) MakeDots() (*Token, *Error) {
+	startPos := *l.Pos
+	dots := ""
+
+	for l.CurrChar == "." && len(dots) < 3 {
+		dots += l.CurrChar
+		l.Advance()
+	}
+
+	if dots == ".." && l.CurrChar == "<" {
+		dots += l.CurrChar
+		l.Advance()
+	}
+
+	endPos := *l.Pos
+	return NewToken(TTOp, dots, &startPos, &endPos), nil
+}
+
+// MakeQuestion makes '?' for the ternary operator, '??' for null coalescing
+// and '?.' or '?[' for optional chaining, the parser turns a '?[' back into a
+// ternary when it's followed by its ':'
+func (l *Lexer) MakeQuestion() *Token {
+	startPos := *l.Pos
+	op := "?"
+
+	l.Advance()
+
+	if l.CurrChar == "?" || l.CurrChar == "[" || (l.CurrChar == "." && l.Peek() != ".") {
+		op += l.CurrChar
+		l.Advance()
+	}
+
+	endPos := *l.Pos
+	return NewToken(TTOp, op, &startPos, &endPos)
+}
+
 func (l *Lexer) MakeGreaterThan() *Token {
 	startPos := *l.Pos
 
@@ -197,7 +293,7 @@ func (l *Lexer) MakeTokens() ([]*Token, *Error) {
 			l.Advance()
 		} else if strings.Contains("\n;", l.CurrChar) {
 			addToken(NewToken(TTNewLine, l.CurrChar, l.Pos, nil), true)
-		} else if strings.Contains(Letters, l.CurrChar) {
+		} else if strings.Contains(Letters + "_", l.CurrChar) {
 			addToken(l.MakeId(), false)
 		} else if strings.Contains(Digits, l.CurrChar) {
 			addToken(l.MakeNumber(), false)
@@ -207,10 +303,14 @@ func (l *Lexer) MakeTokens() ([]*Token, *Error) {
 				return []*Token{}, err
 			}
 			addToken(tok, false)
+		} else if l.CurrChar == "#" && l.KeepComments {
+			addToken(l.MakeComment(), false)
 		} else if l.CurrChar == "#" {
 			l.SkipComment()
 		} else if strings.Contains(SimpleOps, l.CurrChar) {
 			addToken(NewToken(TTOp, l.CurrChar, l.Pos, nil), true)
+		} else if strings.Contains(ArithOps, l.CurrChar) {
+			addToken(l.MakeArithOp(), false)
 		} else if l.CurrChar == "!" {
 			tok, err := l.MakeNotEquals()
 			if err != nil {
@@ -219,6 +319,14 @@ func (l *Lexer) MakeTokens() ([]*Token, *Error) {
 			addToken(tok, false)
 		} else if l.CurrChar == "=" {
 			addToken(l.MakeEquals(), false)
+		} else if l.CurrChar == "?" {
+			addToken(l.MakeQuestion(), false)
+		} else if l.CurrChar == "." {
+			tok, err := l.MakeDots()
+			if err != nil {
+				return []*Token{}, err
+			}
+			addToken(tok, false)
 		} else if l.CurrChar == ">" {
 			addToken(l.MakeGreaterThan(), false)
 		} else if l.CurrChar == "<" {
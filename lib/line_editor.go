@@ -0,0 +1,226 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"unicode/utf8"
+)
+
+// ErrInterrupted is returned by ReadLine when the user presses Ctrl-C
+var ErrInterrupted = errors.New("interrupted")
+
+// stdin is shared so input buffered by one read isn't lost by the next one
+var stdin = bufio.NewReader(os.Stdin)
+
+// LineEditor reads lines with cursor movement, history and completion when
+// stdin is a terminal, and falls back to plain reading otherwise
+type LineEditor struct {
+	History []string
+	Complete func(word string) []string
+	buf []rune
+	pos int
+	prompt string
+}
+
+func NewLineEditor() *LineEditor {
+	e := &LineEditor{}
+	return e
+}
+
+func (e *LineEditor) AddHistory(line string) {
+	if line == "" || len(e.History) > 0 && e.History[len(e.History) - 1] == line {
+		return
+	}
+	e.History = append(e.History, line)
+}
+
+func (e *LineEditor) ReadLine(prompt string) (string, error) {
+	restore, err := MakeRaw(int(os.Stdin.Fd()))
+	if err != nil {
+		return GetInput(prompt)
+	}
+	defer restore()
+
+	e.buf = []rune{}
+	e.pos = 0
+	e.prompt = prompt
+	historyIndex := len(e.History)
+	draft := ""
+
+	fmt.Print(prompt)
+
+	for {
+		r, err := e.readRune()
+		if err != nil {
+			return "", err
+		}
+
+		switch r {
+		case '\r', '\n':
+			fmt.Print("\r\n")
+			return string(e.buf), nil
+		case 3: // Ctrl-C
+			fmt.Print("^C\r\n")
+			return "", ErrInterrupted
+		case 4: // Ctrl-D
+			if len(e.buf) == 0 {
+				fmt.Print("\r\n")
+				return "", io.EOF
+			}
+			e.deleteAt(e.pos)
+		case 127, 8: // Backspace
+			if e.pos > 0 {
+				e.pos--
+				e.deleteAt(e.pos)
+			}
+		case 1: // Ctrl-A
+			e.pos = 0
+		case 5: // Ctrl-E
+			e.pos = len(e.buf)
+		case 11: // Ctrl-K
+			e.buf = e.buf[:e.pos]
+		case 21: // Ctrl-U
+			e.buf = e.buf[e.pos:]
+			e.pos = 0
+		case 12: // Ctrl-L
+			fmt.Print("\033[H\033[2J")
+		case '\t':
+			e.complete()
+		case 27: // Escape sequences
+			seq, err := e.readEscape()
+			if err != nil {
+				return "", err
+			}
+			switch seq {
+			case "[D":
+				if e.pos > 0 {
+					e.pos--
+				}
+			case "[C":
+				if e.pos < len(e.buf) {
+					e.pos++
+				}
+			case "[H", "OH", "[1~":
+				e.pos = 0
+			case "[F", "OF", "[4~":
+				e.pos = len(e.buf)
+			case "[3~":
+				e.deleteAt(e.pos)
+			case "[A", "[B":
+				if historyIndex == len(e.History) {
+					draft = string(e.buf)
+				}
+				if seq == "[A" && historyIndex > 0 {
+					historyIndex--
+				} else if seq == "[B" && historyIndex < len(e.History) {
+					historyIndex++
+				}
+				if historyIndex == len(e.History) {
+					e.buf = []rune(draft)
+				} else {
+					e.buf = []rune(e.History[historyIndex])
+				}
+				e.pos = len(e.buf)
+			}
+		default:
+			if r >= 32 {
+				e.buf = append(e.buf[:e.pos], append([]rune{r}, e.buf[e.pos:]...)...)
+				e.pos++
+			}
+		}
+
+		e.refresh()
+	}
+}
+
+func (e *LineEditor) readRune() (rune, error) {
+	bytes := []byte{}
+	for !utf8.FullRune(bytes) {
+		b, err := stdin.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		bytes = append(bytes, b)
+	}
+	r, _ := utf8.DecodeRune(bytes)
+	return r, nil
+}
+
+// readEscape reads the rest of an escape sequence like "[A" for the up arrow
+func (e *LineEditor) readEscape() (string, error) {
+	b, err := stdin.ReadByte()
+	if err != nil {
+		return "", err
+	}
+	seq := string(b)
+	if b != '[' && b != 'O' {
+		return seq, nil
+	}
+	for {
+		b, err := stdin.ReadByte()
+		if err != nil {
+			return "", err
+		}
+		seq += string(b)
+		if b >= 0x40 && b <= 0x7e {
+			return seq, nil
+		}
+	}
+}
+
+func (e *LineEditor) deleteAt(i int) {
+	if i < len(e.buf) {
+		e.buf = append(e.buf[:i], e.buf[i + 1:]...)
+	}
+}
+
+func (e *LineEditor) refresh() {
+	fmt.Print("\r" + e.prompt + string(e.buf) + "\033[K")
+	if back := len(e.buf) - e.pos; back > 0 {
+		fmt.Printf("\033[%vD", back)
+	}
+}
+
+// complete completes the name before the cursor, when there are many
+// candidates their common prefix is used and they are listed below the line
+func (e *LineEditor) complete() {
+	if e.Complete == nil {
+		return
+	}
+
+	start := e.pos
+	for start > 0 && strings.ContainsRune(IdAllowedChars, e.buf[start - 1]) {
+		start--
+	}
+	word := string(e.buf[start:e.pos])
+	if word == "" {
+		return
+	}
+
+	candidates := e.Complete(word)
+	if len(candidates) == 0 {
+		return
+	}
+
+	prefix := candidates[0]
+	for _, c := range candidates[1:] {
+		for !strings.HasPrefix(c, prefix) {
+			prefix = prefix[:len(prefix) - 1]
+		}
+	}
+
+	if len(prefix) > len(word) {
+		rest := []rune(prefix[len(word):])
+		e.buf = append(e.buf[:e.pos], append(rest, e.buf[e.pos:]...)...)
+		e.pos += len(rest)
+		return
+	}
+
+	if len(candidates) > 1 {
+		fmt.Print("\r\n" + strings.Join(candidates, "  ") + "\r\n")
+	}
+}
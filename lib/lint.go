@@ -0,0 +1,606 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+type LintRule struct {
+	Id, Description string
+}
+
+// LintRules are the checks the linter knows, all of them run by default
+var LintRules = []*LintRule{
+	{"unused-variable", "A variable is assigned but its value is never read"},
+	{"unused-parameter", "A parameter of a function is never read"},
+	{"shadowed-name", "A name bound inside a function hides a name bound outside of it"},
+	{"assignment-in-condition", "A condition is an assignment, which is often a mistyped '=='"},
+	{"unreachable-code", "A statement comes after a return, break or continue and never runs"},
+	{"undefined-name", "A called name isn't defined anywhere"},
+	{"builtin-arity", "A builtin function is called with the wrong number of arguments"},
+	{"zero-step", "A for loop steps by zero so it never advances"},
+}
+
+type LintIssue struct {
+	Rule, Message string
+	StartPos, EndPos *Position
+}
+
+// lintVar is a name bound in a scope, Refs are all the tokens that bind or
+// read it starting with the one that defined it
+type lintVar struct {
+	Name, Kind string
+	StartPos, EndPos *Position
+	Used bool
+	Refs []*Token
+	Fun *FunDefNode
+}
+
+// lintScope holds the names bound by a function, or by a comprehension
+// which keeps its names to itself, the root scope has no position
+type lintScope struct {
+	Vars map[string]*lintVar
+	Parent *lintScope
+	StartPos, EndPos *Position
+}
+
+// Linter walks the AST without running it and reports code that is likely
+// a mistake. Scoping is dynamic so a name read where it isn't bound may
+// belong to any caller, such reads keep variables of that name from being
+// reported as unused
+type Linter struct {
+	Rules map[string]bool
+	Issues []*LintIssue
+	Scope *lintScope
+	// Globals are the names bound outside of functions and Bound are the
+	// names bound anywhere in the file
+	Globals map[string]*lintVar
+	Bound map[string]bool
+	Builtins *SymbolTable
+	Root *lintScope
+	Scopes []*lintScope
+	vars []*lintVar
+	freeReads map[string][]*Token
+}
+
+func NewLinter(rules map[string]bool) *Linter {
+	l := &Linter{
+		Rules: rules,
+		Globals: map[string]*lintVar{},
+		Bound: map[string]bool{},
+		Builtins: NewSymbolTable(),
+		freeReads: map[string][]*Token{},
+	}
+	return l
+}
+
+func (l *Linter) Report(rule, message string, sp, ep *Position) {
+	if !l.Rules[rule] {
+		return
+	}
+	l.Issues = append(l.Issues, &LintIssue{rule, message, sp, ep})
+}
+
+// Lint checks a whole file and returns its issues in the order they appear
+func (l *Linter) Lint(ast interface{}) []*LintIssue {
+	l.collect(ast, true)
+
+	l.Root = &lintScope{Vars: map[string]*lintVar{}}
+	l.Scope = l.Root
+	l.Scopes = []*lintScope{l.Root}
+	l.Block(ast)
+
+	// A read that isn't bound where it is can only be resolved at runtime,
+	// it's most likely a global
+	for name, reads := range l.freeReads {
+		if v, ok := l.Root.Vars[name]; ok {
+			v.Refs = append(v.Refs, reads...)
+		}
+	}
+
+	for _, v := range l.vars {
+		if v.Used || len(l.freeReads[v.Name]) > 0 || strings.HasPrefix(v.Name, "_") {
+			continue
+		}
+		switch v.Kind {
+		case "variable":
+			l.Report("unused-variable", fmt.Sprintf("'%v' is assigned but never used", v.Name), v.StartPos, v.EndPos)
+		case "parameter":
+			l.Report("unused-parameter", fmt.Sprintf("Parameter '%v' is never used", v.Name), v.StartPos, v.EndPos)
+		}
+	}
+
+	sort.SliceStable(l.Issues, func(i, j int) bool {
+		a, b := l.Issues[i].StartPos, l.Issues[j].StartPos
+		return a != nil && (b == nil || a.Index < b.Index)
+	})
+	return l.Issues
+}
+
+// patternTokens returns the name tokens a pattern binds
+func patternTokens(pattern interface{}) []*Token {
+	tokens := []*Token{}
+
+	switch pt := pattern.(type) {
+	case *BindPatternNode:
+		tokens = append(tokens, pt.NameToken)
+	case *ListPatternNode:
+		for _, el := range pt.Elements {
+			tokens = append(tokens, patternTokens(el)...)
+		}
+		if pt.Rest != nil && pt.Rest.Value != "_" {
+			tokens = append(tokens, pt.Rest)
+		}
+	case *MapPatternNode:
+		for _, val := range pt.Values {
+			tokens = append(tokens, patternTokens(val)...)
+		}
+	}
+
+	return tokens
+}
+
+// paramTokens returns the name tokens a parameter binds
+func paramTokens(param *ParamNode) []*Token {
+	if param.Pattern == nil {
+		return []*Token{{Type: TTId, Value: param.Name, StartPos: param.StartPos, EndPos: param.EndPos}}
+	}
+	return patternTokens(param.Pattern)
+}
+
+// collect finds the names bound anywhere in a file before it's checked, so
+// calls and shadowing can be checked against names defined further down
+func (l *Linter) collect(node interface{}, global bool) {
+	bind := func(tok *Token, kind string, global bool) {
+		if tok == nil {
+			return
+		}
+		name := tok.Value.(string)
+		l.Bound[name] = true
+		if _, ok := l.Globals[name]; global && !ok {
+			l.Globals[name] = &lintVar{Name: name, Kind: kind, StartPos: tok.StartPos, EndPos: tok.EndPos}
+		}
+	}
+	bindPattern := func(pattern interface{}, kind string, global bool) {
+		for _, tok := range patternTokens(pattern) {
+			bind(tok, kind, global)
+		}
+	}
+
+	switch n := node.(type) {
+	case *VarAssignNode:
+		bind(n.NameToken, "variable", global)
+	case *LetNode:
+		bind(n.NameToken, "variable", global)
+	case *DestructureAssignNode:
+		bindPattern(n.Pattern, "variable", global)
+	case *ForNode:
+		bind(n.Var, "variable", global)
+	case *EachNode:
+		bind(n.IndexName, "variable", global)
+		bind(n.ItemName, "variable", global)
+		bindPattern(n.ItemPattern, "variable", global)
+	case *WhileLetNode:
+		bindPattern(n.Pattern, "variable", global)
+	case *MatchNode:
+		for _, c := range n.Cases {
+			bindPattern(c.Pattern, "variable", global)
+		}
+	case *EachClauseNode:
+		bind(n.IndexName, "variable", false)
+		bindPattern(n.ItemPattern, "variable", false)
+	case *FunDefNode:
+		bind(n.NameToken, "function", global)
+		for _, param := range n.Params {
+			for _, tok := range paramTokens(param) {
+				l.Bound[tok.Value.(string)] = true
+			}
+		}
+		global = false
+	case *ComprehensionNode:
+		global = false
+	}
+
+	for _, child := range NodeChildren(node) {
+		l.collect(child, global)
+	}
+}
+
+// Lookup finds the variable a name refers to from the current scope
+func (l *Linter) Lookup(name string) *lintVar {
+	for s := l.Scope; s != nil; s = s.Parent {
+		if v, ok := s.Vars[name]; ok {
+			return v
+		}
+	}
+	return nil
+}
+
+func (l *Linter) Read(tok *Token) {
+	name := tok.Value.(string)
+	if v := l.Lookup(name); v != nil {
+		v.Used = true
+		v.Refs = append(v.Refs, tok)
+		return
+	}
+	l.freeReads[name] = append(l.freeReads[name], tok)
+}
+
+// Bind defines a name in the current scope, binding a name that the scope
+// already has is only a reassignment
+func (l *Linter) Bind(tok *Token, kind string) *lintVar {
+	if tok == nil {
+		return nil
+	}
+	name := tok.Value.(string)
+	if v, ok := l.Scope.Vars[name]; ok {
+		v.Refs = append(v.Refs, tok)
+		return v
+	}
+
+	v := &lintVar{Name: name, Kind: kind, StartPos: tok.StartPos, EndPos: tok.EndPos, Refs: []*Token{tok}}
+	l.Scope.Vars[name] = v
+	l.vars = append(l.vars, v)
+
+	if l.Scope.Parent == nil || strings.HasPrefix(name, "_") {
+		return v
+	}
+	if outer := l.lookupOuter(name); outer != nil {
+		l.Report("shadowed-name",
+			fmt.Sprintf("'%v' shadows the %v defined at line %v", name, outer.Kind, outer.StartPos.Line),
+			tok.StartPos, tok.EndPos)
+	}
+	return v
+}
+
+// lookupOuter finds a name outside of the current scope, globals count even
+// when they are bound after the current function
+func (l *Linter) lookupOuter(name string) *lintVar {
+	for s := l.Scope.Parent; s != nil; s = s.Parent {
+		if v, ok := s.Vars[name]; ok && v.StartPos != nil {
+			return v
+		}
+	}
+	if v, ok := l.Globals[name]; ok && v.StartPos != nil {
+		return v
+	}
+	return nil
+}
+
+func (l *Linter) BindPattern(pattern interface{}, kind string) {
+	for _, tok := range patternTokens(pattern) {
+		l.Bind(tok, kind)
+	}
+}
+
+// PushScope starts the scope of a function or a comprehension
+func (l *Linter) PushScope(sp, ep *Position) {
+	l.Scope = &lintScope{Vars: map[string]*lintVar{}, Parent: l.Scope, StartPos: sp, EndPos: ep}
+	l.Scopes = append(l.Scopes, l.Scope)
+}
+
+// Block checks a list of statements, the loop variables and the names bound
+// by patterns are never reported as unused
+func (l *Linter) Block(node interface{}) {
+	list, ok := node.(*ListNode)
+	if !ok {
+		l.Visit(node)
+		return
+	}
+
+	reported := false
+	for i, stmt := range list.Elements {
+		if i > 0 && !reported {
+			jump := ""
+			switch list.Elements[i - 1].(type) {
+			case *ReturnNode:
+				jump = "return"
+			case *BreakNode:
+				jump = "break"
+			case *ContinueNode:
+				jump = "continue"
+			}
+			if sp, ep := FirstPosition(stmt); jump != "" && sp != nil {
+				l.Report("unreachable-code", fmt.Sprintf("Unreachable code after '%v'", jump), sp, ep)
+				reported = true
+			}
+		}
+		l.Visit(stmt)
+	}
+}
+
+// Condition checks a node used as a condition
+func (l *Linter) Condition(node interface{}) {
+	name := ""
+	switch n := node.(type) {
+	case *VarAssignNode:
+		name = fmt.Sprintf("'%v'", n.NameToken.Value)
+	case *CompoundAssignNode:
+		name = "an element"
+		if v, ok := n.Target.(*VarAccessNode); ok {
+			name = fmt.Sprintf("'%v'", v.NameToken.Value)
+		}
+	case *ElementAssignNode:
+		name = "an element"
+	}
+	if name != "" {
+		sp, ep := FirstPosition(node)
+		l.Report("assignment-in-condition",
+			fmt.Sprintf("Assignment to %v used as a condition, use '==' to compare", name), sp, ep)
+	}
+	l.Visit(node)
+}
+
+func (l *Linter) Visit(node interface{}) {
+	switch n := node.(type) {
+	case *VarAccessNode:
+		l.Read(n.NameToken)
+	case *VarAssignNode:
+		l.Visit(n.ValueNode)
+		l.Bind(n.NameToken, "variable")
+	case *LetNode:
+		l.Visit(n.Value)
+		l.Bind(n.NameToken, "variable")
+	case *DestructureAssignNode:
+		l.Visit(n.Value)
+		l.BindPattern(n.Pattern, "variable")
+	case *TernOpNode:
+		l.Condition(n.Cond)
+		l.Visit(n.Left)
+		l.Visit(n.Right)
+	case *IfNode:
+		for _, c := range n.Cases {
+			l.Condition(c[0])
+			l.Block(c[1])
+		}
+		l.Block(n.ElseCase)
+	case *WhileNode:
+		l.Condition(n.Cond)
+		l.Block(n.Exp)
+		l.Block(n.ElseCase)
+	case *WhileLetNode:
+		l.Visit(n.Value)
+		l.BindPattern(n.Pattern, "loop variable")
+		l.Block(n.Body)
+		l.Block(n.ElseCase)
+	case *LoopNode:
+		l.Block(n.Body)
+	case *DoWhileNode:
+		l.Block(n.Body)
+		l.Condition(n.Cond)
+	case *ForNode:
+		l.Visit(n.From)
+		l.Visit(n.To)
+		l.Visit(n.By)
+		if isZero(n.By) {
+			sp, ep := FirstPosition(n.By)
+			l.Report("zero-step", "The step of the for loop is zero so it never advances", sp, ep)
+		}
+		l.Bind(n.Var, "loop variable")
+		l.Block(n.Body)
+		l.Block(n.ElseCase)
+	case *EachNode:
+		l.Visit(n.List)
+		l.Bind(n.IndexName, "loop variable")
+		l.Bind(n.ItemName, "loop variable")
+		l.BindPattern(n.ItemPattern, "loop variable")
+		l.Block(n.Body)
+		l.Block(n.ElseCase)
+	case *ComprehensionNode:
+		l.PushScope(n.StartPos, n.EndPos)
+		for _, clause := range n.Clauses {
+			if each, ok := clause.(*EachClauseNode); ok {
+				l.Visit(each.List)
+				l.Bind(each.IndexName, "loop variable")
+				l.BindPattern(each.ItemPattern, "loop variable")
+			} else {
+				l.Condition(clause)
+			}
+		}
+		l.Visit(n.Key)
+		l.Visit(n.Value)
+		l.Scope = l.Scope.Parent
+	case *MatchNode:
+		l.Visit(n.Value)
+		for _, c := range n.Cases {
+			l.BindPattern(c.Pattern, "variable")
+			if c.Guard != nil {
+				l.Condition(c.Guard)
+			}
+			if body, ok := c.Body.(*ListNode); ok && body.StartPos == nil {
+				l.Block(body)
+			} else {
+				l.Visit(c.Body)
+			}
+		}
+	case *FunDefNode:
+		if v := l.Bind(n.NameToken, "function"); v != nil {
+			v.Used = true
+			v.Fun = n
+		}
+		for _, param := range n.Params {
+			l.Visit(param.Default)
+		}
+
+		l.PushScope(n.StartPos, n.EndPos)
+		for _, param := range n.Params {
+			for _, tok := range paramTokens(param) {
+				l.Bind(tok, "parameter")
+			}
+		}
+		if n.ReturnBody {
+			l.Visit(n.Body)
+		} else {
+			l.Block(n.Body)
+		}
+		l.Scope = l.Scope.Parent
+	case *FunCallNode:
+		l.Call(n)
+		for _, child := range NodeChildren(n) {
+			l.Visit(child)
+		}
+	default:
+		for _, child := range NodeChildren(node) {
+			l.Visit(child)
+		}
+	}
+}
+
+// Call checks that a called name exists, and that a builtin gets as many
+// arguments as it takes unless the file defines a name like it
+func (l *Linter) Call(call *FunCallNode) {
+	name, ok := call.Name.(*VarAccessNode)
+	if !ok {
+		return
+	}
+	id := name.NameToken.Value.(string)
+	if l.Bound[id] {
+		return
+	}
+
+	val := l.Builtins.Get(id)
+	if val == nil {
+		l.Report("undefined-name", fmt.Sprintf("Call to undefined name '%v'", id), name.NameToken.StartPos, name.NameToken.EndPos)
+		return
+	}
+
+	builtin, ok := val.(*BuiltinFunction)
+	if !ok {
+		return
+	}
+	for _, arg := range call.Args {
+		if _, isSpread := arg.(*SpreadNode); isSpread {
+			return
+		}
+	}
+
+	min, max := builtin.Arity()
+	if count := len(call.Args); count < min || max != -1 && count > max {
+		sp, ep := NodePosition(call)
+		l.Report("builtin-arity", fmt.Sprintf("%v expected %v, got %v", builtin, arityText(min, max), count), sp, ep)
+	}
+}
+
+func arityText(min, max int) string {
+	plural := func(n int) string {
+		if n == 1 {
+			return "1 argument"
+		}
+		return fmt.Sprintf("%v arguments", n)
+	}
+
+	if max == -1 {
+		return "at least " + plural(min)
+	}
+	if min != max {
+		return fmt.Sprintf("%v to %v", min, plural(max))
+	}
+	return plural(max)
+}
+
+// isZero reports whether a node is the number literal 0 or -0
+func isZero(node interface{}) bool {
+	if u, ok := node.(*UnaryOpNode); ok && (u.Op.Value == "-" || u.Op.Value == "+") {
+		node = u.Node
+	}
+	n, ok := node.(*NumberNode)
+	return ok && n.Token.Value == 0.0
+}
+
+// lintLocation returns the 1-based line and column of a position, the
+// columns are counted from the text since they start at 0 after the first line
+func lintLocation(pos *Position) (int, int) {
+	if pos == nil {
+		return 0, 0
+	}
+	lineStart := strings.LastIndex(pos.FileText[:pos.Index], "\n") + 1
+	return pos.Line, utf8.RuneCountInString(pos.FileText[lineStart:pos.Index]) + 1
+}
+
+type lintResult struct {
+	File string `json:"file"`
+	Line int `json:"line"`
+	Column int `json:"column"`
+	EndLine int `json:"endLine"`
+	EndColumn int `json:"endColumn"`
+	Rule string `json:"rule"`
+	Message string `json:"message"`
+}
+
+func newLintResult(file string, issue *LintIssue) *lintResult {
+	r := &lintResult{File: file, Rule: issue.Rule, Message: issue.Message}
+	r.Line, r.Column = lintLocation(issue.StartPos)
+	r.EndLine, r.EndColumn = lintLocation(issue.EndPos)
+	if issue.EndPos == nil {
+		r.EndLine, r.EndColumn = r.Line, r.Column
+	}
+	return r
+}
+
+// WriteLintText prints each issue on a line as file:line:col: rule: message
+func WriteLintText(w io.Writer, results []*lintResult) {
+	for _, r := range results {
+		fmt.Fprintf(w, "%v:%v:%v: %v: %v\n", r.File, r.Line, r.Column, r.Rule, r.Message)
+	}
+}
+
+func WriteLintJSON(w io.Writer, results []*lintResult) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(results)
+}
+
+// WriteLintSARIF prints the issues as a SARIF 2.1.0 log, the format code
+// scanning tools read
+func WriteLintSARIF(w io.Writer, results []*lintResult) error {
+	type object = map[string]interface{}
+
+	rules := []object{}
+	for _, rule := range LintRules {
+		rules = append(rules, object{
+			"id": rule.Id,
+			"shortDescription": object{"text": rule.Description},
+		})
+	}
+
+	sarifResults := []object{}
+	for _, r := range results {
+		region := object{"startLine": r.Line, "startColumn": r.Column}
+		if r.EndColumn > r.Column || r.EndLine > r.Line {
+			region["endLine"] = r.EndLine
+			region["endColumn"] = r.EndColumn
+		}
+		location := object{"artifactLocation": object{"uri": filepath.ToSlash(r.File)}}
+		if r.Line > 0 {
+			location["region"] = region
+		}
+		sarifResults = append(sarifResults, object{
+			"ruleId": r.Rule,
+			"level": "warning",
+			"message": object{"text": r.Message},
+			"locations": []object{{"physicalLocation": location}},
+		})
+	}
+
+	log := object{
+		"$schema": "https://json.schemastore.org/sarif-2.1.0.json",
+		"version": "2.1.0",
+		"runs": []object{{
+			"tool": object{"driver": object{
+				"name": "luminary lint",
+				"informationUri": "https://github.com/a7med-mahmoud/luminary",
+				"rules": rules,
+			}},
+			"results": sarifResults,
+		}},
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(log)
+}
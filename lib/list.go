@@ -72,11 +72,14 @@ func (l *List) Pow(other interface{}) (Value, *Error) {
 }
 
 func (l *List) IsEqualTo(other interface{}) Value {
+	if o, ok := other.(Value); ok && ValuesEqual(l, o) {
+		return NewNumber(1)
+	}
 	return NewNumber(0)
 }
 
 func (l *List) IsNotEqualTo(other interface{}) Value {
-	return NewNumber(1)
+	return l.IsEqualTo(other).Not()
 }
 
 func (l *List) IsGreaterThan(other interface{}) (Value, *Error) {
@@ -95,28 +98,6 @@ func (l *List) IsLessThanOrEqual(other interface{}) (Value, *Error) {
 	return nil, NewRuntimeError("Can't compare lists", l.StartPos, nil)
 }
 
-func (l *List) And(other interface{}) (Value, *Error) {
-	if o, ok := other.(Value); ok {
-		if o.IsTrue() {
-			return o, nil
-		}
-		return NewNumber(0), nil
-	}
-
-	return nil, NewRuntimeError("Can't compare values of different types", l.StartPos, nil)
-}
-
-func (l *List) Or(other interface{}) (Value, *Error) {
-	if o, ok := other.(Value); ok {
-		if o.IsTrue() {
-			return o, nil
-		}
-		return NewNumber(0), nil
-	}
-
-	return nil, NewRuntimeError("Can't compare values of different types", l.StartPos, nil)
-}
-
 func (l *List) Not() Value {
 	return NewNumber(0)
 }
@@ -140,23 +121,29 @@ func (l *List) AccessElement(index int, to interface{}, ctx *Context) *RuntimeRe
 	length := int(l.Length.GetVal().(float64))
 
 	if t, ok := to.(int); ok {
-		if length > index {
-			if length >= t {
-				return rr.Success(NewList(l.Elements[index:t]))
-			}
+		if index < 0 || index > length || t < index || t > length {
 			return rr.Failure(NewRuntimeError(
-				fmt.Sprintf("Index out of range (%v) with length of %v", t, length),
+				fmt.Sprintf("Index out of range (%v:%v) with length of %v", index, t, length),
 				l.StartPos, l.EndPos))
 		}
-		return rr.Failure(NewRuntimeError(
-			fmt.Sprintf("Index out of range (%v) with length of %v", index, length),
-			l.StartPos, l.EndPos))
+		return rr.Success(NewList(l.Elements[index:t]))
 	}
 
-	if length > index {
+	if index >= 0 && length > index {
 		return rr.Success(l.Elements[index].(Value))
 	}
 	return rr.Failure(NewRuntimeError(
 		fmt.Sprintf("Index out of range (%v) with length of %v", index, length),
 		l.StartPos, l.EndPos))
 }
+
+func (l *List) Iter() (*Iterator, *Error) {
+	index := 0
+	return NewIterator("list", func() (Value, bool, *Error) {
+		if index >= len(l.Elements) {
+			return nil, false, nil
+		}
+		index += 1
+		return l.Elements[index - 1].(Value), true, nil
+	}), nil
+}
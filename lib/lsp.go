@@ -0,0 +1,565 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// The server speaks the Language Server Protocol over stdio, each document
+// is parsed and linted whenever it changes and the linter's scopes answer
+// the questions about names
+
+type lspPosition struct {
+	Line int `json:"line"`
+	Character int `json:"character"`
+}
+
+type lspRange struct {
+	Start lspPosition `json:"start"`
+	End lspPosition `json:"end"`
+}
+
+type lspLocation struct {
+	URI string `json:"uri"`
+	Range lspRange `json:"range"`
+}
+
+type lspTextEdit struct {
+	Range lspRange `json:"range"`
+	NewText string `json:"newText"`
+}
+
+type lspDiagnostic struct {
+	Range lspRange `json:"range"`
+	Severity int `json:"severity"`
+	Code string `json:"code,omitempty"`
+	Source string `json:"source"`
+	Message string `json:"message"`
+}
+
+type lspDocumentSymbol struct {
+	Name string `json:"name"`
+	Detail string `json:"detail,omitempty"`
+	Kind int `json:"kind"`
+	Range lspRange `json:"range"`
+	SelectionRange lspRange `json:"selectionRange"`
+	Children []*lspDocumentSymbol `json:"children,omitempty"`
+}
+
+type lspCompletionItem struct {
+	Label string `json:"label"`
+	Kind int `json:"kind"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// Kinds of symbols, completion items and diagnostics as numbered by the
+// protocol
+const (
+	lspSymbolFunction = 12
+	lspSymbolVariable = 13
+	lspCompletionFunction = 3
+	lspCompletionVariable = 6
+	lspCompletionKeyword = 14
+	lspSeverityError = 1
+	lspSeverityWarning = 2
+)
+
+type lspMessage struct {
+	ID *json.RawMessage `json:"id"`
+	Method string `json:"method"`
+	Params json.RawMessage `json:"params"`
+}
+
+type lspError struct {
+	Code int `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *lspError) Error() string {
+	return e.Message
+}
+
+type lspTextDocumentParams struct {
+	TextDocument struct {
+		URI string `json:"uri"`
+		Text string `json:"text"`
+	} `json:"textDocument"`
+	Position lspPosition `json:"position"`
+}
+
+type lspDocument struct {
+	URI, Text string
+	Linter *Linter
+	// Known is the last linter that saw the document parse, it's used for
+	// completion while the document has syntax errors
+	Known *Linter
+}
+
+// Offset returns the byte index of a position, characters are counted in
+// UTF-16 code units
+func (d *lspDocument) Offset(pos lspPosition) int {
+	index := 0
+	for line := 0; line < pos.Line; line++ {
+		next := strings.IndexByte(d.Text[index:], '\n')
+		if next == -1 {
+			return len(d.Text)
+		}
+		index += next + 1
+	}
+	for units := 0; units < pos.Character && index < len(d.Text) && d.Text[index] != '\n'; {
+		r, size := utf8.DecodeRuneInString(d.Text[index:])
+		units += utf16Len(r)
+		index += size
+	}
+	return index
+}
+
+// Position returns the protocol position of a byte index
+func (d *lspDocument) Position(index int) lspPosition {
+	if index > len(d.Text) {
+		index = len(d.Text)
+	}
+	if index < 0 {
+		index = 0
+	}
+	pos := lspPosition{}
+	lineStart := 0
+	for i := 0; i < index; i++ {
+		if d.Text[i] == '\n' {
+			pos.Line++
+			lineStart = i + 1
+		}
+	}
+	for _, r := range d.Text[lineStart:index] {
+		pos.Character += utf16Len(r)
+	}
+	return pos
+}
+
+func utf16Len(r rune) int {
+	if r >= 0x10000 {
+		return 2
+	}
+	return 1
+}
+
+func (d *lspDocument) Range(sp, ep *Position) lspRange {
+	if sp == nil {
+		return lspRange{}
+	}
+	if ep == nil || ep.Index < sp.Index {
+		ep = sp
+	}
+	return lspRange{d.Position(sp.Index), d.Position(ep.Index)}
+}
+
+func (d *lspDocument) Location(tok *Token) lspLocation {
+	return lspLocation{d.URI, d.Range(tok.StartPos, tok.EndPos)}
+}
+
+// Analyze parses and lints the document and returns its diagnostics
+func (d *lspDocument) Analyze() []*lspDiagnostic {
+	diagnostics := []*lspDiagnostic{}
+
+	ast, err := Parse(uriPath(d.URI), d.Text)
+	if err != nil {
+		d.Linter = nil
+		return append(diagnostics, &lspDiagnostic{
+			Range: d.Range(err.StartPos, err.EndPos),
+			Severity: lspSeverityError,
+			Source: "luminary",
+			Message: err.Name + ": " + err.Details,
+		})
+	}
+
+	rules := map[string]bool{}
+	for _, rule := range LintRules {
+		rules[rule.Id] = true
+	}
+	d.Linter = NewLinter(rules)
+	d.Known = d.Linter
+	for _, issue := range d.Linter.Lint(ast) {
+		diagnostics = append(diagnostics, &lspDiagnostic{
+			Range: d.Range(issue.StartPos, issue.EndPos),
+			Severity: lspSeverityWarning,
+			Code: issue.Rule,
+			Source: "luminary",
+			Message: issue.Message,
+		})
+	}
+	return diagnostics
+}
+
+// VarAt finds the variable whose name is at a byte index, along with the
+// token of the name. A name that isn't bound anywhere is returned with a nil
+// variable so builtins can be found
+func (d *lspDocument) VarAt(index int) (*lintVar, *Token) {
+	if d.Linter == nil {
+		return nil, nil
+	}
+	at := func(tok *Token) bool {
+		return tok.StartPos != nil && tok.StartPos.Index <= index && index <= tok.EndPos.Index
+	}
+	for _, v := range d.Linter.vars {
+		for _, ref := range v.Refs {
+			if at(ref) {
+				return v, ref
+			}
+		}
+	}
+	for _, reads := range d.Linter.freeReads {
+		for _, tok := range reads {
+			if at(tok) {
+				return nil, tok
+			}
+		}
+	}
+	return nil, nil
+}
+
+// Signature describes a function the way it's written in code
+func Signature(fun *FunDefNode) string {
+	f := NewFunction(fun.Name, fun.Params, fun.Body, fun.ReturnBody, fun.IsGenerator).(*Function)
+	str := "fun " + f.String()
+	if fun.ReturnType != nil {
+		str += " -> " + fun.ReturnType.String()
+	}
+	return str
+}
+
+type LanguageServer struct {
+	Documents map[string]*lspDocument
+	in *bufio.Reader
+	out io.Writer
+	shutdown bool
+}
+
+func NewLanguageServer(in *bufio.Reader, out io.Writer) *LanguageServer {
+	s := &LanguageServer{
+		Documents: map[string]*lspDocument{},
+		in: in,
+		out: out,
+	}
+	return s
+}
+
+// Serve handles messages until the client asks the server to exit, it
+// returns the exit code
+func (s *LanguageServer) Serve() int {
+	for {
+		content, err := ReadMessage(s.in)
+		if err != nil {
+			return 1
+		}
+
+		msg := &lspMessage{}
+		if err := json.Unmarshal(content, msg); err != nil {
+			s.reply(nil, nil, &lspError{-32700, "Parse error"})
+			continue
+		}
+		if msg.Method == "exit" {
+			if s.shutdown {
+				return 0
+			}
+			return 1
+		}
+
+		result, lspErr := s.handle(msg)
+		if msg.ID != nil {
+			s.reply(msg.ID, result, lspErr)
+		}
+	}
+}
+
+func (s *LanguageServer) write(msg map[string]interface{}) {
+	msg["jsonrpc"] = "2.0"
+	WriteMessage(s.out, msg)
+}
+
+func (s *LanguageServer) reply(id *json.RawMessage, result interface{}, err *lspError) {
+	msg := map[string]interface{}{"id": id}
+	if err != nil {
+		msg["error"] = err
+	} else {
+		msg["result"] = result
+	}
+	s.write(msg)
+}
+
+func (s *LanguageServer) notify(method string, params interface{}) {
+	s.write(map[string]interface{}{"method": method, "params": params})
+}
+
+func (s *LanguageServer) handle(msg *lspMessage) (interface{}, *lspError) {
+	params := &lspTextDocumentParams{}
+	json.Unmarshal(msg.Params, params)
+	uri := params.TextDocument.URI
+
+	switch msg.Method {
+	case "initialize":
+		return map[string]interface{}{
+			"capabilities": map[string]interface{}{
+				"textDocumentSync": 1,
+				"hoverProvider": true,
+				"definitionProvider": true,
+				"referencesProvider": true,
+				"renameProvider": true,
+				"documentSymbolProvider": true,
+				"documentFormattingProvider": true,
+				"completionProvider": map[string]interface{}{},
+			},
+			"serverInfo": map[string]interface{}{"name": "luminary"},
+		}, nil
+	case "shutdown":
+		s.shutdown = true
+		return nil, nil
+	case "textDocument/didOpen":
+		s.Update(uri, params.TextDocument.Text)
+	case "textDocument/didChange":
+		change := &struct {
+			ContentChanges []struct {
+				Text string `json:"text"`
+			} `json:"contentChanges"`
+		}{}
+		json.Unmarshal(msg.Params, change)
+		if n := len(change.ContentChanges); n > 0 {
+			s.Update(uri, change.ContentChanges[n - 1].Text)
+		}
+	case "textDocument/didClose":
+		delete(s.Documents, uri)
+		s.notify("textDocument/publishDiagnostics", map[string]interface{}{"uri": uri, "diagnostics": []*lspDiagnostic{}})
+	}
+
+	doc := s.Documents[uri]
+	if doc == nil || msg.ID == nil {
+		if msg.ID != nil && strings.HasPrefix(msg.Method, "textDocument/") {
+			return nil, nil
+		}
+		if msg.ID != nil {
+			return nil, &lspError{-32601, "Method not found: " + msg.Method}
+		}
+		return nil, nil
+	}
+	index := doc.Offset(params.Position)
+
+	switch msg.Method {
+	case "textDocument/hover":
+		return s.Hover(doc, index), nil
+	case "textDocument/definition":
+		if v, _ := doc.VarAt(index); v != nil {
+			return doc.Location(v.Refs[0]), nil
+		}
+		return nil, nil
+	case "textDocument/references":
+		refs := &struct {
+			Context struct {
+				IncludeDeclaration bool `json:"includeDeclaration"`
+			} `json:"context"`
+		}{}
+		json.Unmarshal(msg.Params, refs)
+		return s.References(doc, index, refs.Context.IncludeDeclaration), nil
+	case "textDocument/rename":
+		rename := &struct {
+			NewName string `json:"newName"`
+		}{}
+		json.Unmarshal(msg.Params, rename)
+		return s.Rename(doc, index, rename.NewName)
+	case "textDocument/completion":
+		return s.Completion(doc, index), nil
+	case "textDocument/documentSymbol":
+		return s.Symbols(doc), nil
+	case "textDocument/formatting":
+		out, err := Format(uriPath(uri), doc.Text)
+		if err != nil || out == doc.Text {
+			return []lspTextEdit{}, nil
+		}
+		end := doc.Position(len(doc.Text))
+		return []lspTextEdit{{lspRange{lspPosition{}, end}, out}}, nil
+	}
+	return nil, &lspError{-32601, "Method not found: " + msg.Method}
+}
+
+// Update replaces the text of a document and publishes its diagnostics
+func (s *LanguageServer) Update(uri, text string) {
+	doc := s.Documents[uri]
+	if doc == nil {
+		doc = &lspDocument{URI: uri}
+		s.Documents[uri] = doc
+	}
+	doc.Text = text
+	s.notify("textDocument/publishDiagnostics", map[string]interface{}{
+		"uri": uri,
+		"diagnostics": doc.Analyze(),
+	})
+}
+
+func (s *LanguageServer) Hover(doc *lspDocument, index int) interface{} {
+	v, tok := doc.VarAt(index)
+	if tok == nil {
+		return nil
+	}
+
+	text := ""
+	switch {
+	case v != nil && v.Fun != nil:
+		text = Signature(v.Fun)
+	case v != nil:
+		text = fmt.Sprintf("(%v) %v", v.Kind, v.Name)
+	default:
+		builtin, ok := doc.Linter.Builtins.Get(tok.Value.(string)).(*BuiltinFunction)
+		if !ok {
+			return nil
+		}
+		text = "(builtin) fun " + strings.TrimPrefix(builtin.String(), "builtin:")
+	}
+
+	return map[string]interface{}{
+		"contents": map[string]interface{}{
+			"kind": "markdown",
+			"value": "```luminary\n" + text + "\n```",
+		},
+		"range": doc.Range(tok.StartPos, tok.EndPos),
+	}
+}
+
+func (s *LanguageServer) References(doc *lspDocument, index int, declaration bool) []lspLocation {
+	locations := []lspLocation{}
+	v, _ := doc.VarAt(index)
+	if v == nil {
+		return locations
+	}
+	for i, ref := range v.Refs {
+		if i == 0 && !declaration {
+			continue
+		}
+		locations = append(locations, doc.Location(ref))
+	}
+	return locations
+}
+
+func (s *LanguageServer) Rename(doc *lspDocument, index int, name string) (interface{}, *lspError) {
+	v, _ := doc.VarAt(index)
+	if v == nil {
+		return nil, &lspError{-32602, "There is no variable or function to rename here"}
+	}
+	if !IsIdentifier(name) {
+		return nil, &lspError{-32602, fmt.Sprintf("'%v' isn't a valid name", name)}
+	}
+
+	edits := []lspTextEdit{}
+	seen := map[int]bool{}
+	for _, ref := range v.Refs {
+		if seen[ref.StartPos.Index] {
+			continue
+		}
+		seen[ref.StartPos.Index] = true
+		edits = append(edits, lspTextEdit{doc.Range(ref.StartPos, ref.EndPos), name})
+	}
+	return map[string]interface{}{
+		"changes": map[string][]lspTextEdit{doc.URI: edits},
+	}, nil
+}
+
+// Completion returns the names bound in the scopes around an index, the
+// builtins and the keywords
+func (s *LanguageServer) Completion(doc *lspDocument, index int) []*lspCompletionItem {
+	items := []*lspCompletionItem{}
+	seen := map[string]bool{}
+	add := func(item *lspCompletionItem) {
+		if !seen[item.Label] {
+			seen[item.Label] = true
+			items = append(items, item)
+		}
+	}
+
+	if linter := doc.Known; linter != nil {
+		for _, scope := range linter.Scopes {
+			if scope.StartPos != nil && (index < scope.StartPos.Index || index > scope.EndPos.Index) {
+				continue
+			}
+			for _, v := range scope.Vars {
+				if v.Fun != nil {
+					add(&lspCompletionItem{v.Name, lspCompletionFunction, Signature(v.Fun)})
+				} else {
+					add(&lspCompletionItem{v.Name, lspCompletionVariable, v.Kind})
+				}
+			}
+		}
+	}
+
+	for name, val := range NewSymbolTable().Symbols {
+		if builtin, ok := val.(*BuiltinFunction); ok {
+			add(&lspCompletionItem{name, lspCompletionFunction, strings.TrimPrefix(builtin.String(), "builtin:")})
+		} else {
+			add(&lspCompletionItem{name, lspCompletionVariable, "builtin"})
+		}
+	}
+	for _, keyword := range Keywords {
+		add(&lspCompletionItem{keyword, lspCompletionKeyword, "keyword"})
+	}
+
+	sort.Slice(items, func(i, j int) bool { return items[i].Label < items[j].Label })
+	return items
+}
+
+// Symbols returns the functions and variables of a document, the names
+// bound inside a function are its children
+func (s *LanguageServer) Symbols(doc *lspDocument) []*lspDocumentSymbol {
+	if doc.Linter == nil {
+		return []*lspDocumentSymbol{}
+	}
+
+	scopes := map[*Position]*lintScope{}
+	for _, scope := range doc.Linter.Scopes {
+		if scope.StartPos != nil {
+			scopes[scope.StartPos] = scope
+		}
+	}
+
+	var symbols func(scope *lintScope) []*lspDocumentSymbol
+	symbols = func(scope *lintScope) []*lspDocumentSymbol {
+		list := []*lspDocumentSymbol{}
+		for _, v := range scope.Vars {
+			if v.Kind == "parameter" || v.Kind == "loop variable" {
+				continue
+			}
+			selection := doc.Range(v.StartPos, v.EndPos)
+			symbol := &lspDocumentSymbol{Name: v.Name, Kind: lspSymbolVariable, Range: selection, SelectionRange: selection}
+			if v.Fun != nil {
+				symbol.Kind = lspSymbolFunction
+				symbol.Detail = Signature(v.Fun)
+				symbol.Range = doc.Range(v.Fun.StartPos, v.Fun.EndPos)
+				if inner, ok := scopes[v.Fun.StartPos]; ok {
+					symbol.Children = symbols(inner)
+				}
+			}
+			list = append(list, symbol)
+		}
+		sort.Slice(list, func(i, j int) bool {
+			a, b := list[i].SelectionRange.Start, list[j].SelectionRange.Start
+			return a.Line < b.Line || a.Line == b.Line && a.Character < b.Character
+		})
+		return list
+	}
+	return symbols(doc.Linter.Root)
+}
+
+// uriPath returns the file path of a file:// URI
+func uriPath(uri string) string {
+	if u, err := url.Parse(uri); err == nil && u.Scheme == "file" {
+		return u.Path
+	}
+	return uri
+}
+
+// ServeLSP runs the language server on the standard input and output
+func ServeLSP() {
+	os.Exit(NewLanguageServer(stdin, os.Stdout).Serve())
+}
@@ -1,81 +1,363 @@
 package main
 
 import (
-	"bufio"
 	"fmt"
+	"io"
 	"os"
+	"path/filepath"
 	"strings"
 )
 
 func GetInput(prompt string) (string, error) {
-	r := bufio.NewReader(os.Stdin)
-
 	fmt.Print(prompt)
-	input, err := r.ReadString('\n')
+	input, err := stdin.ReadString('\n')
+
+	if err == io.EOF && input != "" {
+		err = nil
+	}
 
-	return input[:len(input) - 1], err
+	return strings.TrimSuffix(input, "\n"), err
 }
 
 var globalSymbolTable = NewSymbolTable()
 
-func Run(t string) []interface{} {
+func Run(fn, t string) []interface{} {
 	if strings.TrimSpace(t) == "" {
 		return []interface{}{}
 	}
 
-	lexer := NewLexer(t, "<stdin>", "")
-	tokens, err := lexer.MakeTokens()
-
+	ast, err := Parse(fn, t)
 	if err != nil {
 		fmt.Println(err)
 		return []interface{}{}
 	}
+	if ActiveCoverage != nil {
+		ActiveCoverage.Add(fn, ast)
+	}
 
-	parser := NewParser(tokens, -1)
-	ast := parser.Parse()
-	
-	if ast.Error != nil {
-		fmt.Println(ast.Error)
+	res := Exec(ast)
+	if res.Error != nil {
+		fmt.Println(res.Error)
 		return []interface{}{}
 	}
-	
+
+	return res.Value.GetVal().([]interface{})
+}
+
+// Exec runs an AST in the global scope
+func Exec(ast interface{}) *RuntimeResult {
 	interp := NewInterpretor()
 	ctx := NewContext("<root>")
 	ctx.SymbolTable = globalSymbolTable
 
-	res := interp.Visit(ast.Node, ctx)
+	return interp.Visit(ast, ctx)
+}
 
-	if res.Error != nil {
-		fmt.Println(res.Error)
-		return []interface{}{}
+// Parse returns the AST of a file or the error that stopped it from parsing
+func Parse(fn, t string) (interface{}, *Error) {
+	lexer := NewLexer(t, fn, t)
+	tokens, err := lexer.MakeTokens()
+	if err != nil {
+		return nil, err
 	}
 
-	return res.Value.GetVal().([]interface{})
+	ast := NewParser(tokens, -1).Parse()
+	return ast.Node, ast.Error
 }
 
-func main() {
-	if len(os.Args) < 2 {
-		for {
-			text, err := GetInput("\033[33mLuminary %\033[37m ")
+// Check type checks files and prints the errors it finds, it reports whether
+// all the files are free of errors
+func Check(files []string) bool {
+	ok := true
+	for _, file := range files {
+		content, err := os.ReadFile(file)
+		if err != nil {
+			fmt.Println("Failed to load file", file)
+			ok = false
+			continue
+		}
+
+		ast, parseErr := Parse(file, string(content))
+		if parseErr != nil {
+			fmt.Println(parseErr)
+			ok = false
+			continue
+		}
+
+		checker := NewChecker()
+		checker.Check(ast)
+		for _, e := range checker.Errors {
+			fmt.Println(e)
+			ok = false
+		}
+	}
+	return ok
+}
 
-			if err != nil {
-				fmt.Println(err)
-				break
+// LumFiles returns the paths of files and the .lum files inside directories
+func LumFiles(paths []string) []string {
+	files := []string{}
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil || !info.IsDir() {
+			files = append(files, path)
+			continue
+		}
+		filepath.Walk(path, func(p string, info os.FileInfo, err error) error {
+			if err == nil && !info.IsDir() && strings.HasSuffix(p, ".lum") {
+				files = append(files, p)
 			}
+			return nil
+		})
+	}
+	return files
+}
+
+// FormatFiles formats files in place, `--check` only lists the files that
+// aren't formatted and `--diff` prints the changes instead of making them.
+// With no files it formats the standard input to the standard output
+func FormatFiles(args []string) bool {
+	check, diff := false, false
+	paths := []string{}
+	for _, arg := range args {
+		switch arg {
+		case "--check":
+			check = true
+		case "--diff":
+			diff = true
+		default:
+			paths = append(paths, arg)
+		}
+	}
 
-			res := Run(text)
-			for _, val := range res {
-				fmt.Println(val)
+	format := func(name, src string) (string, bool) {
+		out, err := Format(name, src)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return "", false
+		}
+		if diff {
+			fmt.Print(UnifiedDiff(src, out, name, name + " (formatted)"))
+		}
+		return out, true
+	}
+
+	if len(paths) == 0 {
+		src, err := io.ReadAll(stdin)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Failed to read the standard input")
+			return false
+		}
+		out, ok := format("<stdin>", string(src))
+		if !ok {
+			return false
+		}
+		if !check && !diff {
+			fmt.Print(out)
+		}
+		return !check || out == string(src)
+	}
+
+	ok := true
+	for _, file := range LumFiles(paths) {
+		content, err := os.ReadFile(file)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Failed to load file", file)
+			ok = false
+			continue
+		}
+
+		src := string(content)
+		out, formatted := format(file, src)
+		if !formatted {
+			ok = false
+			continue
+		}
+		if out == src {
+			continue
+		}
+
+		if check {
+			if !diff {
+				fmt.Println(file)
+			}
+			ok = false
+		} else if !diff {
+			if err := os.WriteFile(file, []byte(out), 0644); err != nil {
+				fmt.Fprintln(os.Stderr, "Failed to write file", file)
+				ok = false
 			}
 		}
-		return
+	}
+	return ok
+}
+
+// LintFiles lints files and prints their issues as text, JSON or SARIF. Rules
+// can be turned off using `--disable a,b` or picked using `--rules a,b`, it
+// reports whether no issues were found
+func LintFiles(args []string) bool {
+	format := "text"
+	rules := map[string]bool{}
+	for _, rule := range LintRules {
+		rules[rule.Id] = true
+	}
+
+	setRules := func(list string, enabled bool) bool {
+		for _, id := range strings.Split(list, ",") {
+			if _, ok := rules[id]; !ok {
+				fmt.Fprintf(os.Stderr, "Unknown lint rule '%v'\n", id)
+				return false
+			}
+			rules[id] = enabled
+		}
+		return true
+	}
+
+	paths := []string{}
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if (arg == "--format" || arg == "--disable" || arg == "--rules") && i + 1 < len(args) {
+			i++
+			switch arg {
+			case "--format":
+				format = args[i]
+			case "--disable":
+				if !setRules(args[i], false) {
+					os.Exit(2)
+				}
+			case "--rules":
+				for id := range rules {
+					rules[id] = false
+				}
+				if !setRules(args[i], true) {
+					os.Exit(2)
+				}
+			}
+			continue
+		}
+		paths = append(paths, arg)
+	}
+	if format != "text" && format != "json" && format != "sarif" {
+		fmt.Fprintf(os.Stderr, "Unknown format '%v', expected text, json or sarif\n", format)
+		os.Exit(2)
+	}
+
+	ok := true
+	results := []*lintResult{}
+	for _, file := range LumFiles(paths) {
+		content, err := os.ReadFile(file)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Failed to load file", file)
+			ok = false
+			continue
+		}
+
+		ast, parseErr := Parse(file, string(content))
+		if parseErr != nil {
+			fmt.Fprintln(os.Stderr, parseErr)
+			ok = false
+			continue
+		}
+
+		for _, issue := range NewLinter(rules).Lint(ast) {
+			results = append(results, newLintResult(file, issue))
+		}
 	}
 
-	file := os.Args[1]
+	switch format {
+	case "json":
+		WriteLintJSON(os.Stdout, results)
+	case "sarif":
+		WriteLintSARIF(os.Stdout, results)
+	default:
+		WriteLintText(os.Stdout, results)
+	}
+	return ok && len(results) == 0
+}
+
+func RunFile(file string) {
 	content, err := os.ReadFile(file)
 	if err != nil {
 		fmt.Println("Failed to load file")
 		return
 	}
-	Run(string(content))
+	Run(file, string(content))
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		NewRepl().Start()
+		return
+	}
+
+	switch os.Args[1] {
+	case "check":
+		if len(os.Args) < 3 {
+			fmt.Println("Usage: luminary check <file>...")
+			os.Exit(2)
+		}
+		if !Check(os.Args[2:]) {
+			os.Exit(1)
+		}
+	case "fmt":
+		if !FormatFiles(os.Args[2:]) {
+			os.Exit(1)
+		}
+	case "lint":
+		if len(os.Args) < 3 {
+			fmt.Println("Usage: luminary lint [--format text|json|sarif] [--disable rules] [--rules rules] <file>...")
+			os.Exit(2)
+		}
+		if !LintFiles(os.Args[2:]) {
+			os.Exit(1)
+		}
+	case "test":
+		if !TestCommand(os.Args[2:]) {
+			os.Exit(1)
+		}
+	case "debug":
+		ServeDAP()
+	case "lsp":
+		ServeLSP()
+	case "run":
+		usage := "Usage: luminary run [--check-types] [--profile] [--profile-out file] [--coverage] [--coverage-out file] <file>"
+		args := os.Args[2:]
+		profile, profileOut := false, ""
+		coverage, coverageOut := false, ""
+		for len(args) > 0 && strings.HasPrefix(args[0], "--") {
+			switch {
+			case args[0] == "--check-types":
+				EnforceTypes = true
+			case args[0] == "--profile":
+				profile = true
+			case args[0] == "--profile-out" && len(args) > 1:
+				profile, profileOut = true, args[1]
+				args = args[1:]
+			case args[0] == "--coverage":
+				coverage = true
+			case args[0] == "--coverage-out" && len(args) > 1:
+				coverage, coverageOut = true, args[1]
+				args = args[1:]
+			default:
+				fmt.Println(usage)
+				os.Exit(2)
+			}
+			args = args[1:]
+		}
+		if len(args) < 1 {
+			fmt.Println(usage)
+			os.Exit(2)
+		}
+		if profile {
+			StartProfile(args[0], profileOut)
+		}
+		if coverage {
+			StartCoverage(coverageOut)
+		}
+		RunFile(args[0])
+		StopProfile()
+		StopCoverage()
+	default:
+		RunFile(os.Args[1])
+	}
 }
@@ -0,0 +1,183 @@
+package main
+
+import "fmt"
+
+type Map struct {
+	Keys []string
+	Values map[string]Value
+	StartPos, EndPos *Position
+}
+
+func NewMap(keys []string, values map[string]Value) *Map {
+	m := &Map{Keys: keys, Values: values}
+	return m
+}
+
+func (m *Map) String() string {
+	str := "{"
+	for i, key := range m.Keys {
+		if i != 0 {
+			str += ", "
+		}
+		str += key + ": " + m.Values[key].String()
+	}
+	str += "}"
+	return str
+}
+
+func (m *Map) Get(key string) (Value, bool) {
+	val, ok := m.Values[key]
+	return val, ok
+}
+
+func (m *Map) Set(key string, val Value) {
+	if _, ok := m.Values[key]; !ok {
+		m.Keys = append(m.Keys, key)
+	}
+	m.Values[key] = val
+}
+
+func (m *Map) SetPos(sp, ep *Position) Value {
+	m.StartPos = sp
+	m.EndPos = ep
+	if ep == nil {
+		endPos := *sp
+		endPos.Advance("")
+		m.EndPos = &endPos
+	}
+	return m
+}
+
+func (m *Map) AddTo(other interface{}) (Value, *Error) {
+	if o, ok := other.(*Map); ok {
+		res := NewMap([]string{}, map[string]Value{})
+		for _, key := range m.Keys {
+			res.Set(key, m.Values[key])
+		}
+		for _, key := range o.Keys {
+			res.Set(key, o.Values[key])
+		}
+		return res, nil
+	}
+	return nil, NewInvalidSyntaxError("Only maps can be merged with a map", m.StartPos, m.EndPos)
+}
+
+func (m *Map) SubBy(other interface{}) (Value, *Error) {
+	return nil, NewInvalidSyntaxError("Invalid '-' operation on a map", m.StartPos, m.EndPos)
+}
+
+func (m *Map) MulBy(other interface{}) (Value, *Error) {
+	return nil, NewInvalidSyntaxError("Invalid '*' operation on a map", m.StartPos, m.EndPos)
+}
+
+func (m *Map) DivBy(other interface{}) (Value, *Error) {
+	return nil, NewInvalidSyntaxError("Invalid '/' operation on a map", m.StartPos, m.EndPos)
+}
+
+func (m *Map) Mod(other interface{}) (Value, *Error) {
+	return nil, NewInvalidSyntaxError("Invalid '%' operation on a map", m.StartPos, m.EndPos)
+}
+
+func (m *Map) Pow(other interface{}) (Value, *Error) {
+	return nil, NewInvalidSyntaxError("Invalid '^' operation on a map", m.StartPos, m.EndPos)
+}
+
+// ValuesEqual compares lists and maps by their elements, and any other values
+// using ==
+func ValuesEqual(a, b Value) bool {
+	switch x := a.(type) {
+	case *List:
+		y, ok := b.(*List)
+		if !ok || len(x.Elements) != len(y.Elements) {
+			return false
+		}
+		for i := range x.Elements {
+			if !ValuesEqual(x.Elements[i].(Value), y.Elements[i].(Value)) {
+				return false
+			}
+		}
+		return true
+	case *Map:
+		y, ok := b.(*Map)
+		if !ok || len(x.Keys) != len(y.Keys) {
+			return false
+		}
+		for _, key := range x.Keys {
+			other, ok := y.Values[key]
+			if !ok || !ValuesEqual(x.Values[key], other) {
+				return false
+			}
+		}
+		return true
+	case *Null:
+		_, ok := b.(*Null)
+		return ok
+	}
+	if _, ok := b.(*Null); ok {
+		return false
+	}
+	return a.IsEqualTo(b).IsTrue()
+}
+
+func (m *Map) IsEqualTo(other interface{}) Value {
+	if o, ok := other.(Value); ok && ValuesEqual(m, o) {
+		return NewNumber(1)
+	}
+	return NewNumber(0)
+}
+
+func (m *Map) IsNotEqualTo(other interface{}) Value {
+	return m.IsEqualTo(other).Not()
+}
+
+func (m *Map) IsGreaterThan(other interface{}) (Value, *Error) {
+	return nil, NewInvalidSyntaxError("Can't compare maps", m.StartPos, m.EndPos)
+}
+
+func (m *Map) IsGreaterThanOrEqual(other interface{}) (Value, *Error) {
+	return nil, NewRuntimeError("Can't compare maps", m.StartPos, nil)
+}
+
+func (m *Map) IsLessThan(other interface{}) (Value, *Error) {
+	return nil, NewRuntimeError("Can't compare maps", m.StartPos, nil)
+}
+
+func (m *Map) IsLessThanOrEqual(other interface{}) (Value, *Error) {
+	return nil, NewRuntimeError("Can't compare maps", m.StartPos, nil)
+}
+
+func (m *Map) Not() Value {
+	return NewNumber(0)
+}
+
+func (m *Map) IsTrue() bool {
+	return true
+}
+
+func (m *Map) GetVal() interface{} {
+	return m.Values
+}
+
+func (m *Map) Call(args []interface{}, ctx *Context) *RuntimeResult {
+	rr := NewRuntimeResult()
+	return rr.Failure(NewRuntimeError("Can't call a map value", m.StartPos, m.EndPos))
+}
+
+func (m *Map) AccessElement(index int, to interface{}, ctx *Context) *RuntimeResult {
+	rr := NewRuntimeResult()
+	return rr.Failure(NewRuntimeError(
+		fmt.Sprintf("Can't access a map element by a number (%v), use a string key", index),
+		m.StartPos, m.EndPos))
+}
+
+func (m *Map) Iter() (*Iterator, *Error) {
+	keys := append([]string{}, m.Keys...)
+	index := 0
+	return NewIterator("map", func() (Value, bool, *Error) {
+		if index >= len(keys) {
+			return nil, false, nil
+		}
+		index += 1
+		return NewString(keys[index - 1]), true, nil
+	}), nil
+}
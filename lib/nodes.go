@@ -86,6 +86,38 @@ func NewVarAssignNode(n *Token, v interface{}) *VarAssignNode {
 }
 
 
+type LetNode struct {
+	NameToken *Token
+	Type *TypeNode
+	Value interface{}
+}
+
+func NewLetNode(n *Token, t *TypeNode, v interface{}) *LetNode {
+	l := &LetNode{
+		NameToken: n,
+		Type: t,
+		Value: v,
+	}
+
+	return l
+}
+
+type CompoundAssignNode struct {
+	Target interface{}
+	Op *Token
+	Value interface{}
+}
+
+func NewCompoundAssignNode(t interface{}, o *Token, v interface{}) *CompoundAssignNode {
+	c := &CompoundAssignNode{
+		Target: t,
+		Op: o,
+		Value: v,
+	}
+
+	return c
+}
+
 type VarAccessNode struct {
 	NameToken *Token
 }
@@ -114,6 +146,8 @@ func NewIfNode(cases [][2]interface{}, elseCase interface{}) *IfNode {
 
 type WhileNode struct {
 	Cond, Exp interface{}
+	Label string
+	ElseCase interface{}
 }
 
 func NewWhileNode(c, e interface{}) *WhileNode {
@@ -125,9 +159,52 @@ func NewWhileNode(c, e interface{}) *WhileNode {
 	return w
 }
 
+type WhileLetNode struct {
+	Pattern interface{}
+	Value, Body interface{}
+	Label string
+	ElseCase interface{}
+}
+
+func NewWhileLetNode(pt, v, b interface{}) *WhileLetNode {
+	w := &WhileLetNode{
+		Pattern: pt,
+		Value: v,
+		Body: b,
+	}
+
+	return w
+}
+
+type LoopNode struct {
+	Body interface{}
+	Label string
+}
+
+func NewLoopNode(b interface{}) *LoopNode {
+	l := &LoopNode{Body: b}
+	return l
+}
+
+type DoWhileNode struct {
+	Body, Cond interface{}
+	Label string
+}
+
+func NewDoWhileNode(b, c interface{}) *DoWhileNode {
+	d := &DoWhileNode{
+		Body: b,
+		Cond: c,
+	}
+
+	return d
+}
+
 type ForNode struct {
 	Var *Token
 	From, To, By, Body interface{}
+	Label string
+	ElseCase interface{}
 }
 
 func NewForNode(v *Token, f, t, b, bd interface{}) *ForNode {
@@ -156,19 +233,108 @@ func NewTernOpNode(c, l, r interface{}) *TernOpNode {
 	return t
 }
 
+type IsNode struct {
+	Node interface{}
+	Type *TypeNode
+}
+
+func NewIsNode(n interface{}, t *TypeNode) *IsNode {
+	i := &IsNode{
+		Node: n,
+		Type: t,
+	}
+	return i
+}
+
+type TypeNode struct {
+	Name string
+	Args []*TypeNode
+	Nullable bool
+	StartPos, EndPos *Position
+}
+
+func NewTypeNode(n string, a []*TypeNode, sp, ep *Position) *TypeNode {
+	t := &TypeNode{
+		Name: n,
+		Args: a,
+		StartPos: sp,
+		EndPos: ep,
+	}
+	return t
+}
+
+func (t *TypeNode) String() string {
+	str := t.Name
+	if len(t.Args) > 0 {
+		str += "["
+		for i, arg := range t.Args {
+			if i != 0 {
+				str += ", "
+			}
+			str += arg.String()
+		}
+		str += "]"
+	}
+	if t.Nullable {
+		str += "?"
+	}
+	return str
+}
+
+type ParamNode struct {
+	Name string
+	Pattern interface{}
+	Default interface{}
+	DefaultText string
+	Variadic bool
+	Type *TypeNode
+	StartPos, EndPos *Position
+}
+
+func NewParamNode(n string, pt interface{}, d interface{}, dt string, v bool) *ParamNode {
+	p := &ParamNode{
+		Name: n,
+		Pattern: pt,
+		Default: d,
+		DefaultText: dt,
+		Variadic: v,
+	}
+
+	return p
+}
+
+func (p *ParamNode) String() string {
+	str := p.Name
+	if p.Variadic {
+		str = "..." + str
+	}
+	if p.Type != nil {
+		str += ": " + p.Type.String()
+	}
+	if p.Default != nil {
+		str += " = " + p.DefaultText
+	}
+	return str
+}
+
 type FunDefNode struct {
 	Name string
-	ArgNames []string
+	Params []*ParamNode
 	Body interface{}
 	ReturnBody bool
+	IsGenerator bool
+	ReturnType *TypeNode
+	NameToken *Token
+	StartPos, EndPos *Position
 }
 
-func NewFunDefNode(n string, a []string, b interface{}, sh bool) *FunDefNode {
+func NewFunDefNode(n string, a []*ParamNode, b interface{}, sh bool, g bool) *FunDefNode {
 	f := &FunDefNode{
 		Name: n,
-		ArgNames: a,
+		Params: a,
 		Body: b,
 		ReturnBody: sh,
+		IsGenerator: g,
 	}
 
 	return f
@@ -177,6 +343,9 @@ func NewFunDefNode(n string, a []string, b interface{}, sh bool) *FunDefNode {
 type FunCallNode struct {
 	Name interface{}
 	Args []interface{}
+	// Optional calls with '?.()' skip the chain on a null function, Chained
+	// calls come after such a link and are skipped with it
+	Optional, Chained bool
 }
 
 func NewFunCallNode(n interface{}, a []interface{}) *FunCallNode {
@@ -188,8 +357,31 @@ func NewFunCallNode(n interface{}, a []interface{}) *FunCallNode {
 	return f
 }
 
+type SpreadNode struct {
+	Node interface{}
+}
+
+func NewSpreadNode(n interface{}) *SpreadNode {
+	s := &SpreadNode{Node: n}
+	return s
+}
+
+type KeywordArgNode struct {
+	NameToken *Token
+	Value interface{}
+}
+
+func NewKeywordArgNode(n *Token, v interface{}) *KeywordArgNode {
+	k := &KeywordArgNode{
+		NameToken: n,
+		Value: v,
+	}
+	return k
+}
+
 type ListNode struct {
 	Elements []interface{}
+	StartPos, EndPos *Position
 }
 
 func NewListNode(el []interface{}) *ListNode {
@@ -206,18 +398,35 @@ func NewReturnNode(v interface{}) *ReturnNode {
 	return r
 }
 
-type ContinueNode struct {}
+type YieldNode struct {
+	Token *Token
+	Value interface{}
+}
+
+func NewYieldNode(t *Token, v interface{}) *YieldNode {
+	y := &YieldNode{
+		Token: t,
+		Value: v,
+	}
+	return y
+}
 
-func NewContinueNode() *ContinueNode {
-	r := &ContinueNode{}
+type ContinueNode struct {
+	Label string
+}
+
+func NewContinueNode(l string) *ContinueNode {
+	r := &ContinueNode{Label: l}
 	return r
 }
 
 
-type BreakNode struct {}
+type BreakNode struct {
+	Label string
+}
 
-func NewBreakNode() *BreakNode {
-	r := &BreakNode{}
+func NewBreakNode(l string) *BreakNode {
+	r := &BreakNode{Label: l}
 	return r
 }
 
@@ -225,43 +434,500 @@ type ElementAccessNode struct {
 	Node interface{}
 	Index interface{}
 	To interface{}
+	// Optional accesses with '?.' or '?[' skip the chain on a null value,
+	// Chained ones come after such a link and are skipped with it
+	Optional, Chained bool
+	StartPos, EndPos *Position
 }
 
-func NewElementAccessNode(n, i, t interface{}) *ElementAccessNode {
+func NewElementAccessNode(n, i, t interface{}, sp, ep *Position) *ElementAccessNode {
 	e := &ElementAccessNode{
 		Node: n,
 		Index: i,
 		To: t,
+		StartPos: sp,
+		EndPos: ep,
 	}
 	return e
 }
 
 type ElementAssignNode struct {
-	NameToken *Token
+	Node interface{}
 	Index interface{}
 	Value interface{}
+	StartPos, EndPos *Position
 }
 
-func NewElementAssignNode(n *Token, i, v interface{}) *ElementAssignNode {
+func NewElementAssignNode(n, i, v interface{}, sp, ep *Position) *ElementAssignNode {
 	e := &ElementAssignNode{
-		NameToken: n,
+		Node: n,
 		Index: i,
 		Value: v,
+		StartPos: sp,
+		EndPos: ep,
 	}
 	return e
 }
 
 type EachNode struct {
 	List interface{}
+	IndexName *Token
 	ItemName *Token
+	ItemPattern interface{}
 	Body interface{}
+	Label string
+	ElseCase interface{}
 }
 
-func NewEachNode(l interface{}, i *Token, b interface{}) *EachNode {
+func NewEachNode(l interface{}, in *Token, i *Token, ip interface{}, b interface{}) *EachNode {
 	e := &EachNode{
 		List: l,
+		IndexName: in,
 		ItemName: i,
+		ItemPattern: ip,
 		Body: b,
 	}
 	return e
 }
+
+type EachClauseNode struct {
+	List interface{}
+	IndexName *Token
+	ItemPattern interface{}
+}
+
+func NewEachClauseNode(l interface{}, in *Token, ip interface{}) *EachClauseNode {
+	e := &EachClauseNode{
+		List: l,
+		IndexName: in,
+		ItemPattern: ip,
+	}
+	return e
+}
+
+type ComprehensionNode struct {
+	Key interface{}
+	Value interface{}
+	Clauses []interface{}
+	StartPos, EndPos *Position
+}
+
+func NewComprehensionNode(k, v interface{}, c []interface{}, sp, ep *Position) *ComprehensionNode {
+	cn := &ComprehensionNode{
+		Key: k,
+		Value: v,
+		Clauses: c,
+		StartPos: sp,
+		EndPos: ep,
+	}
+	return cn
+}
+
+type MapNode struct {
+	Keys []string
+	Values []interface{}
+	StartPos, EndPos *Position
+}
+
+func NewMapNode(k []string, v []interface{}) *MapNode {
+	m := &MapNode{
+		Keys: k,
+		Values: v,
+	}
+	return m
+}
+
+type WildcardPatternNode struct {
+	Token *Token
+}
+
+func NewWildcardPatternNode(t *Token) *WildcardPatternNode {
+	w := &WildcardPatternNode{Token: t}
+	return w
+}
+
+func (w *WildcardPatternNode) String() string {
+	return "_"
+}
+
+type BindPatternNode struct {
+	NameToken *Token
+}
+
+func NewBindPatternNode(n *Token) *BindPatternNode {
+	b := &BindPatternNode{NameToken: n}
+	return b
+}
+
+func (b *BindPatternNode) String() string {
+	return b.NameToken.Value.(string)
+}
+
+type ValuePatternNode struct {
+	Node interface{}
+}
+
+func NewValuePatternNode(n interface{}) *ValuePatternNode {
+	v := &ValuePatternNode{Node: n}
+	return v
+}
+
+type ListPatternNode struct {
+	Elements []interface{}
+	Rest *Token
+}
+
+func NewListPatternNode(el []interface{}, r *Token) *ListPatternNode {
+	l := &ListPatternNode{
+		Elements: el,
+		Rest: r,
+	}
+	return l
+}
+
+func (l *ListPatternNode) String() string {
+	str := "["
+	for i, el := range l.Elements {
+		if i != 0 {
+			str += ", "
+		}
+		str += fmt.Sprintf("%v", el)
+	}
+	if l.Rest != nil {
+		if len(l.Elements) > 0 {
+			str += ", "
+		}
+		str += "..." + l.Rest.Value.(string)
+	}
+	str += "]"
+	return str
+}
+
+type MapPatternNode struct {
+	Keys []string
+	Values []interface{}
+}
+
+func NewMapPatternNode(k []string, v []interface{}) *MapPatternNode {
+	m := &MapPatternNode{
+		Keys: k,
+		Values: v,
+	}
+	return m
+}
+
+func (m *MapPatternNode) String() string {
+	str := "{"
+	for i, key := range m.Keys {
+		if i != 0 {
+			str += ", "
+		}
+		if b, ok := m.Values[i].(*BindPatternNode); ok && b.NameToken.Value == key {
+			str += key
+		} else {
+			str += fmt.Sprintf("%v: %v", key, m.Values[i])
+		}
+	}
+	str += "}"
+	return str
+}
+
+type DestructureAssignNode struct {
+	Pattern interface{}
+	Value interface{}
+}
+
+func NewDestructureAssignNode(pt, v interface{}) *DestructureAssignNode {
+	d := &DestructureAssignNode{
+		Pattern: pt,
+		Value: v,
+	}
+	return d
+}
+
+func PatternNames(pattern interface{}) []string {
+	names := []string{}
+
+	switch pt := pattern.(type) {
+	case *BindPatternNode:
+		names = append(names, pt.NameToken.Value.(string))
+	case *ListPatternNode:
+		for _, el := range pt.Elements {
+			names = append(names, PatternNames(el)...)
+		}
+		if pt.Rest != nil && pt.Rest.Value != "_" {
+			names = append(names, pt.Rest.Value.(string))
+		}
+	case *MapPatternNode:
+		for _, val := range pt.Values {
+			names = append(names, PatternNames(val)...)
+		}
+	}
+
+	return names
+}
+
+type MatchCase struct {
+	Pattern, Guard, Body interface{}
+}
+
+type MatchNode struct {
+	Token *Token
+	Value interface{}
+	Cases []*MatchCase
+}
+
+func NewMatchNode(t *Token, v interface{}, c []*MatchCase) *MatchNode {
+	m := &MatchNode{
+		Token: t,
+		Value: v,
+		Cases: c,
+	}
+	return m
+}
+
+// NodePosition returns where a node starts and ends in the source, nodes
+// that don't keep positions return nil
+func NodePosition(node interface{}) (*Position, *Position) {
+	switch n := node.(type) {
+	case *NumberNode:
+		return n.Token.StartPos, n.Token.EndPos
+	case *StringNode:
+		return n.Token.StartPos, n.Token.EndPos
+	case *NullNode:
+		return n.Token.StartPos, n.Token.EndPos
+	case *VarAccessNode:
+		return n.NameToken.StartPos, n.NameToken.EndPos
+	case *VarAssignNode:
+		_, end := NodePosition(n.ValueNode)
+		return n.NameToken.StartPos, end
+	case *LetNode:
+		_, end := NodePosition(n.Value)
+		return n.NameToken.StartPos, end
+	case *BinOpNode:
+		start, _ := NodePosition(n.Left)
+		_, end := NodePosition(n.Right)
+		return start, end
+	case *UnaryOpNode:
+		_, end := NodePosition(n.Node)
+		return n.Op.StartPos, end
+	case *IsNode:
+		start, _ := NodePosition(n.Node)
+		return start, n.Type.EndPos
+	case *TernOpNode:
+		start, _ := NodePosition(n.Cond)
+		_, end := NodePosition(n.Right)
+		return start, end
+	case *ListNode:
+		if n.StartPos == nil && len(n.Elements) > 0 {
+			start, _ := NodePosition(n.Elements[0])
+			_, end := NodePosition(n.Elements[len(n.Elements) - 1])
+			return start, end
+		}
+		return n.StartPos, n.EndPos
+	case *MapNode:
+		return n.StartPos, n.EndPos
+	case *FunDefNode:
+		return n.StartPos, n.EndPos
+	case *FunCallNode:
+		start, end := NodePosition(n.Name)
+		if len(n.Args) > 0 {
+			_, end = NodePosition(n.Args[len(n.Args) - 1])
+		}
+		return start, end
+	case *ElementAccessNode:
+		return n.StartPos, n.EndPos
+	case *ElementAssignNode:
+		return n.StartPos, n.EndPos
+	case *ComprehensionNode:
+		return n.StartPos, n.EndPos
+	case *MatchNode:
+		return n.Token.StartPos, n.Token.EndPos
+	case *YieldNode:
+		return n.Token.StartPos, n.Token.EndPos
+	case *SpreadNode:
+		return NodePosition(n.Node)
+	case *KeywordArgNode:
+		_, end := NodePosition(n.Value)
+		return n.NameToken.StartPos, end
+	}
+	return nil, nil
+}
+
+// StatementNodes returns the statements of a program in the order they're
+// written, which are the statements of blocks and the bodies of functions
+// written as a single expression. They're where a debugger pauses and what
+// coverage counts
+func StatementNodes(ast interface{}) []interface{} {
+	stmts := []interface{}{}
+	addStatement := func(node interface{}) {
+		if sp, _ := FirstPosition(node); sp != nil {
+			stmts = append(stmts, node)
+		}
+	}
+
+	var collect func(node interface{}, block bool)
+	collect = func(node interface{}, block bool) {
+		if node == nil {
+			return
+		}
+		if list, ok := node.(*ListNode); ok && block {
+			for _, stmt := range list.Elements {
+				addStatement(stmt)
+				collect(stmt, false)
+			}
+			return
+		}
+		if block {
+			addStatement(node)
+		}
+
+		switch n := node.(type) {
+		case *IfNode:
+			for _, c := range n.Cases {
+				collect(c[0], false)
+				collect(c[1], true)
+			}
+			collect(n.ElseCase, true)
+		case *WhileNode:
+			collect(n.Cond, false)
+			collect(n.Exp, true)
+			collect(n.ElseCase, true)
+		case *WhileLetNode:
+			collect(n.Value, false)
+			collect(n.Body, true)
+			collect(n.ElseCase, true)
+		case *LoopNode:
+			collect(n.Body, true)
+		case *DoWhileNode:
+			collect(n.Body, true)
+			collect(n.Cond, false)
+		case *ForNode:
+			collect(n.From, false)
+			collect(n.To, false)
+			collect(n.By, false)
+			collect(n.Body, true)
+			collect(n.ElseCase, true)
+		case *EachNode:
+			collect(n.List, false)
+			collect(n.Body, true)
+			collect(n.ElseCase, true)
+		case *FunDefNode:
+			for _, param := range n.Params {
+				collect(param.Default, false)
+			}
+			collect(n.Body, true)
+		case *MatchNode:
+			collect(n.Value, false)
+			for _, c := range n.Cases {
+				collect(c.Guard, false)
+				body, isBlock := c.Body.(*ListNode)
+				collect(c.Body, isBlock && body.StartPos == nil)
+			}
+		default:
+			for _, child := range NodeChildren(node) {
+				collect(child, false)
+			}
+		}
+	}
+	collect(ast, true)
+	return stmts
+}
+
+// NodeChildren returns the expressions and statements directly inside a node
+// in the order they appear, patterns and types are left out
+func NodeChildren(node interface{}) []interface{} {
+	children := []interface{}{}
+
+	switch n := node.(type) {
+	case *BinOpNode:
+		children = append(children, n.Left, n.Right)
+	case *UnaryOpNode:
+		children = append(children, n.Node)
+	case *IsNode:
+		children = append(children, n.Node)
+	case *TernOpNode:
+		children = append(children, n.Cond, n.Left, n.Right)
+	case *VarAssignNode:
+		children = append(children, n.ValueNode)
+	case *LetNode:
+		children = append(children, n.Value)
+	case *CompoundAssignNode:
+		children = append(children, n.Target, n.Value)
+	case *DestructureAssignNode:
+		children = append(children, n.Value)
+	case *IfNode:
+		for _, c := range n.Cases {
+			children = append(children, c[0], c[1])
+		}
+		children = append(children, n.ElseCase)
+	case *WhileNode:
+		children = append(children, n.Cond, n.Exp, n.ElseCase)
+	case *WhileLetNode:
+		children = append(children, n.Value, n.Body, n.ElseCase)
+	case *LoopNode:
+		children = append(children, n.Body)
+	case *DoWhileNode:
+		children = append(children, n.Body, n.Cond)
+	case *ForNode:
+		children = append(children, n.From, n.To, n.By, n.Body, n.ElseCase)
+	case *EachNode:
+		children = append(children, n.List, n.Body, n.ElseCase)
+	case *EachClauseNode:
+		children = append(children, n.List)
+	case *ComprehensionNode:
+		children = append(children, n.Clauses...)
+		children = append(children, n.Key, n.Value)
+	case *FunDefNode:
+		for _, param := range n.Params {
+			children = append(children, param.Default)
+		}
+		children = append(children, n.Body)
+	case *FunCallNode:
+		children = append(children, n.Name)
+		children = append(children, n.Args...)
+	case *SpreadNode:
+		children = append(children, n.Node)
+	case *KeywordArgNode:
+		children = append(children, n.Value)
+	case *ListNode:
+		children = append(children, n.Elements...)
+	case *MapNode:
+		children = append(children, n.Values...)
+	case *ReturnNode:
+		children = append(children, n.Value)
+	case *YieldNode:
+		children = append(children, n.Value)
+	case *ElementAccessNode:
+		children = append(children, n.Node, n.Index, n.To)
+	case *ElementAssignNode:
+		children = append(children, n.Node, n.Index, n.Value)
+	case *MatchNode:
+		children = append(children, n.Value)
+		for _, c := range n.Cases {
+			children = append(children, c.Guard, c.Body)
+		}
+	}
+
+	nonNil := []interface{}{}
+	for _, child := range children {
+		if child != nil {
+			nonNil = append(nonNil, child)
+		}
+	}
+	return nonNil
+}
+
+// FirstPosition returns the position of a node, or of its first child that
+// has one when the node doesn't keep its position
+func FirstPosition(node interface{}) (*Position, *Position) {
+	if sp, ep := NodePosition(node); sp != nil {
+		return sp, ep
+	}
+	for _, child := range NodeChildren(node) {
+		if sp, ep := FirstPosition(child); sp != nil {
+			return sp, ep
+		}
+	}
+	return nil, nil
+}
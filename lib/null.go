@@ -78,21 +78,6 @@ func (n *Null) IsLessThanOrEqual(other interface{}) (Value, *Error) {
 	return nil, NewRuntimeError("Can't compare null values", n.StartPos, nil)
 }
 
-func (n *Null) And(other interface{}) (Value, *Error) {
-	return NewNumber(0), nil
-}
-
-func (n *Null) Or(other interface{}) (Value, *Error) {
-	if o, ok := other.(Value); ok {
-		if o.IsTrue() {
-			return o, nil
-		}
-		return NewNumber(0), nil
-	}
-
-	return nil, NewRuntimeError("Can't compare values of different types", n.StartPos, nil)
-}
-
 func (n *Null) Not() Value {
 	return NewNumber(1)
 }
@@ -114,3 +99,7 @@ func (n *Null) AccessElement(index int, to interface{}, ctx *Context) *RuntimeRe
 	rr := NewRuntimeResult()
 	return rr.Failure(NewRuntimeError("Can't access element from a null value", n.StartPos, n.EndPos))
 }
+
+func (n *Null) Iter() (*Iterator, *Error) {
+	return nil, NewRuntimeError("Can't iterate over a null value", n.StartPos, n.EndPos)
+}
@@ -170,31 +170,6 @@ func (n *Number) IsLessThanOrEqual(other interface{}) (Value, *Error) {
 	return nil, NewRuntimeError("Can't compare values of different types", n.StartPos, nil)
 }
 
-func (n *Number) And(other interface{}) (Value, *Error) {
-	if o, ok := other.(Value); ok {
-		if n.IsTrue() && o.IsTrue() {
-			return o, nil
-		}
-		return NewNumber(0), nil
-	}
-
-	return nil, NewRuntimeError("Can't compare values of different types", n.StartPos, nil)
-}
-
-func (n *Number) Or(other interface{}) (Value, *Error) {
-	if o, ok := other.(Value); ok {
-		if n.IsTrue() {
-			return n, nil
-		}
-		if o.IsTrue() {
-			return o, nil
-		}
-		return NewNumber(0), nil
-	}
-
-	return nil, NewRuntimeError("Can't compare values of different types", n.StartPos, nil)
-}
-
 func (n *Number) Not() Value {
 	if n.IsTrue() {
 		return NewNumber(0)
@@ -219,3 +194,7 @@ func (n *Number) AccessElement(index int, to interface{}, ctx *Context) *Runtime
 	rr := NewRuntimeResult()
 	return rr.Failure(NewRuntimeError("Can't access element from a number", n.StartPos, n.EndPos))
 }
+
+func (n *Number) Iter() (*Iterator, *Error) {
+	return nil, NewRuntimeError("Can't iterate over a number", n.StartPos, n.EndPos)
+}
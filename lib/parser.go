@@ -1,14 +1,23 @@
 package main
 
+import "fmt"
+
+var CompoundAssignOps = []string{"+=", "-=", "*=", "/=", "%=", "^="}
+
 type Parser struct {
 	Tokens []*Token
 	TokenIndex int
 	CurrToken *Token
+	FunYields []bool
+	LoopLabels []string
+	// Colons is how many ':' the expressions being parsed wait for, like the
+	// one of a ternary, so a '?[' that leaves none for them is a ternary too
+	Colons int
 }
 
 func NewParser(t []*Token, i int) *Parser {
 	p := &Parser{
-		Tokens: t,
+		Tokens: SplitIncrements(t),
 		TokenIndex: i,
 	}
 
@@ -85,12 +94,100 @@ func (p *Parser) Reverse(amount int) *Token {
 	return p.CurrToken
 }
 
+func (p *Parser) PeekToken(offset int) *Token {
+	if p.TokenIndex + offset < len(p.Tokens) {
+		return p.Tokens[p.TokenIndex + offset]
+	}
+	return p.Tokens[len(p.Tokens) - 1]
+}
+
 func (p *Parser) UpdateToken() {
 	if p.TokenIndex < len(p.Tokens) {
 		p.CurrToken = p.Tokens[p.TokenIndex]
 	}
 }
 
+// SplitOp splits an operator into its first character and the rest, for
+// operators like '?[' that turn out to be two
+func SplitOp(t *Token) (*Token, *Token) {
+	op := t.Value.(string)
+	mid := *t.StartPos
+	mid.Advance(op[:1])
+
+	return NewToken(TTOp, op[:1], t.StartPos, &mid), NewToken(TTOp, op[1:], &mid, t.EndPos)
+}
+
+// SplitToken splits the current operator using SplitOp
+func (p *Parser) SplitToken() {
+	first, rest := SplitOp(p.CurrToken)
+
+	tokens := append([]*Token{}, p.Tokens[:p.TokenIndex]...)
+	tokens = append(tokens, first, rest)
+	p.Tokens = append(tokens, p.Tokens[p.TokenIndex + 1:]...)
+	p.UpdateToken()
+}
+
+// SplitIncrements splits the '++' and '--' that aren't at the end of a
+// statement into two operators, so `3--1` is `3 - -1`
+func SplitIncrements(tokens []*Token) []*Token {
+	split := []*Token{}
+	for i, t := range tokens {
+		isIncrement := t.Type == TTOp && (t.Value == "++" || t.Value == "--")
+		if isIncrement && i + 1 < len(tokens) && !EndsIncrement(tokens[i + 1]) {
+			first, rest := SplitOp(t)
+			split = append(split, first, rest)
+			continue
+		}
+		split = append(split, t)
+	}
+	return split
+}
+
+// EndsIncrement reports whether a token can follow a '++' or '--' statement,
+// like the end of a line or the ',' after a match arm
+func EndsIncrement(t *Token) bool {
+	if t.Type == TTNewLine || t.Type == TTEOF || t.Type == TTComment {
+		return true
+	}
+	return t.Type == TTOp && Contains([]string{")", "]", "}", ","}, t.Value.(string))
+}
+
+// TernaryAhead reports whether the '?[' at the current token is a ternary
+// '?' followed by a list, which is when the rest of the expression has a ':'
+// for it that no enclosing expression waits for, like in `c?[1]:[2]`
+func (p *Parser) TernaryAhead() bool {
+	depth, questions, colons := 1, 0, 0
+
+	for _, t := range p.Tokens[p.TokenIndex + 1:] {
+		if t.Type == TTEOF || t.Type == TTNewLine && depth == 0 {
+			break
+		}
+		if t.Type != TTOp {
+			continue
+		}
+		switch t.Value {
+		case "(", "[", "{", "?[":
+			depth++
+		case ")", "]", "}":
+			depth--
+		}
+		if depth < 0 || depth == 0 && t.Value == "," {
+			break
+		}
+		if depth == 0 && t.Value == "?" {
+			questions++
+		} else if depth == 0 && t.Value == ":" {
+			if questions > 0 {
+				questions--
+			} else {
+				colons++
+			}
+		}
+	}
+
+	return colons > p.Colons
+}
+
 func (p *Parser) Parse() *ParseResult {
 	pr := p.Statements()
 
@@ -147,13 +244,17 @@ func (p *Parser) Statements() *ParseResult {
 			break
 		}
 
-		stmt := pr.TryRegister(p.Statement())
-		if stmt == nil {
-			p.Reverse(pr.ToReverseCount)
+		// A statement that fails before reading any token ends the statements,
+		// one that read some of its tokens was an error in it
+		res := p.Statement()
+		if res.Error != nil && res.AdvanceCount > 0 {
+			return pr.Failure(res.Error)
+		}
+		if res.Error != nil {
 			more = false
 			continue
 		}
-		stmts = append(stmts, stmt)
+		stmts = append(stmts, pr.Register(res))
 	}
 
 	return pr.Success(NewListNode(stmts))
@@ -166,7 +267,7 @@ func (p *Parser) Statement() *ParseResult {
 		pr.RegisterAdvance()
 		p.Advance()
 
-		exp := pr.TryRegister(p.Exp())
+		exp := pr.TryRegister(p.ExpList())
 
 		if exp == nil {
 			pr.Register(pr.ToReverseCount)
@@ -175,16 +276,115 @@ func (p *Parser) Statement() *ParseResult {
 		return pr.Success(NewReturnNode(exp))
 	}
 
-	if p.CurrToken.Type == TTKeyword && p.CurrToken.Value == "continue" {
+	if p.CurrToken.Type == TTKeyword && p.CurrToken.Value == "yield" {
+		yieldToken := p.CurrToken
+
+		if len(p.FunYields) == 0 {
+			return pr.Failure(NewInvalidSyntaxError(
+				"'yield' can only be used inside a function", yieldToken.StartPos, yieldToken.EndPos))
+		}
+		p.FunYields[len(p.FunYields) - 1] = true
+
+		pr.RegisterAdvance()
+		p.Advance()
+
+		var exp interface{} = nil
+		if p.CurrToken.Type != TTNewLine && p.CurrToken.Type != TTEOF &&
+			(p.CurrToken.Type != TTOp || p.CurrToken.Value != "}") {
+			exp = pr.Register(p.Exp())
+			if pr.Error != nil {
+				return pr
+			}
+		}
+
+		return pr.Success(NewYieldNode(yieldToken, exp))
+	}
+
+	if p.CurrToken.Type == TTKeyword && p.CurrToken.Value == "let" {
+		pr.RegisterAdvance()
+		p.Advance()
+
+		if p.CurrToken.Type != TTId {
+			return pr.Failure(NewInvalidSyntaxError(
+				"Expected identifier", p.CurrToken.StartPos, p.CurrToken.EndPos))
+		}
+		name := p.CurrToken
+
+		pr.RegisterAdvance()
+		p.Advance()
+
+		typ := pr.Register(p.OptionalType(":"))
+		if pr.Error != nil {
+			return pr
+		}
+
+		if p.CurrToken.Type != TTOp || p.CurrToken.Value != "=" {
+			return pr.Failure(NewInvalidSyntaxError(
+				"Expected '='", p.CurrToken.StartPos, p.CurrToken.EndPos))
+		}
+
 		pr.RegisterAdvance()
 		p.Advance()
-		return pr.Success(NewContinueNode())
+		pr.Register(p.SkipNewLines())
+
+		value := pr.Register(p.Exp())
+		if pr.Error != nil {
+			return pr
+		}
+
+		t, _ := typ.(*TypeNode)
+		return pr.Success(NewLetNode(name, t, value))
 	}
 
-	if p.CurrToken.Type == TTKeyword && p.CurrToken.Value == "break" {
+	if p.CurrToken.Type == TTKeyword && (p.CurrToken.Value == "continue" || p.CurrToken.Value == "break") {
+		keyword := p.CurrToken.Value
 		pr.RegisterAdvance()
 		p.Advance()
-		return pr.Success(NewBreakNode())
+
+		label := ""
+		if p.CurrToken.Type == TTId {
+			label = p.CurrToken.Value.(string)
+			if !Contains(p.LoopLabels, label) {
+				return pr.Failure(NewInvalidSyntaxError(
+					fmt.Sprintf("Unknown loop label '%v'", label), p.CurrToken.StartPos, p.CurrToken.EndPos))
+			}
+			pr.RegisterAdvance()
+			p.Advance()
+		}
+
+		if keyword == "continue" {
+			return pr.Success(NewContinueNode(label))
+		}
+		return pr.Success(NewBreakNode(label))
+	}
+
+	if p.CurrToken.Type == TTId && p.PeekToken(1).Type == TTOp && p.PeekToken(1).Value == ":" {
+		if next := p.PeekToken(2); next.Type == TTKeyword && Contains(LoopKeywords, next.Value) {
+			return p.LabeledLoop()
+		}
+	}
+
+	if p.CurrToken.Type == TTId || p.CurrToken.Type == TTOp && (p.CurrToken.Value == "[" || p.CurrToken.Value == "{" || p.CurrToken.Value == "...") {
+		tokenIndex := p.TokenIndex
+		target := pr.TryRegister(p.AssignTargets())
+
+		_, isBind := target.(*BindPatternNode)
+		_, isElement := target.(*ElementAccessNode)
+
+		if target != nil && !isBind && !isElement {
+			pr.RegisterAdvance()
+			p.Advance()
+			pr.Register(p.SkipNewLines())
+
+			value := pr.Register(p.ExpList())
+			if pr.Error != nil {
+				return pr
+			}
+
+			return pr.Success(NewDestructureAssignNode(target, value))
+		}
+
+		p.Reverse(p.TokenIndex - tokenIndex)
 	}
 
 	exp := pr.Register(p.Exp())
@@ -193,6 +393,25 @@ func (p *Parser) Statement() *ParseResult {
 		return pr
 	}
 
+	if p.CurrToken.Type == TTOp && (p.CurrToken.Value == "++" || p.CurrToken.Value == "--") {
+		op := p.CurrToken
+
+		_, isVar := exp.(*VarAccessNode)
+		el, isElement := exp.(*ElementAccessNode)
+		if !isVar && (!isElement || el.To != nil) {
+			return pr.Failure(NewInvalidSyntaxError(
+				fmt.Sprintf("Expected a variable or an element before '%v'", op.Value),
+				op.StartPos,
+				op.EndPos))
+		}
+
+		pr.RegisterAdvance()
+		p.Advance()
+
+		one := NewNumberNode(NewToken(TTNum, 1.0, op.StartPos, op.EndPos))
+		return pr.Success(NewCompoundAssignNode(exp, op, one))
+	}
+
 	return pr.Success(exp)
 }
 
@@ -331,6 +550,64 @@ func (p *Parser) IfExp() *ParseResult {
 	return pr.Success(NewIfNode(cases, elseCase))
 }
 
+var LoopKeywords = []string{"for", "while", "each", "loop", "do"}
+
+// LabeledLoop parses 'label: <loop>', the label can then be used by break
+// and continue statements inside the loop body
+func (p *Parser) LabeledLoop() *ParseResult {
+	pr := NewParseResult()
+
+	label := p.CurrToken.Value.(string)
+	pr.RegisterAdvance()
+	p.Advance()
+	pr.RegisterAdvance()
+	p.Advance()
+
+	p.LoopLabels = append(p.LoopLabels, label)
+	loop := pr.Register(p.Atom())
+	p.LoopLabels = p.LoopLabels[:len(p.LoopLabels) - 1]
+
+	if pr.Error != nil {
+		return pr
+	}
+
+	switch l := loop.(type) {
+	case *ForNode:
+		l.Label = label
+	case *WhileNode:
+		l.Label = label
+	case *EachNode:
+		l.Label = label
+	case *WhileLetNode:
+		l.Label = label
+	case *LoopNode:
+		l.Label = label
+	case *DoWhileNode:
+		l.Label = label
+	}
+
+	return pr.Success(loop)
+}
+
+// LoopElse parses the optional 'else { }' block right after a loop's body
+func (p *Parser) LoopElse() *ParseResult {
+	pr := NewParseResult()
+
+	if p.CurrToken.Type != TTKeyword || p.CurrToken.Value != "else" {
+		return pr.Success(nil)
+	}
+
+	pr.RegisterAdvance()
+	p.Advance()
+
+	block := pr.Register(p.Block())
+	if pr.Error != nil {
+		return pr
+	}
+
+	return pr.Success(block)
+}
+
 func (p *Parser) WhileExp() *ParseResult {
 	pr := NewParseResult()
 	
@@ -346,6 +623,10 @@ func (p *Parser) WhileExp() *ParseResult {
 
 	pr.Register(p.SkipNewLines())
 
+	if p.CurrToken.Type == TTKeyword && p.CurrToken.Value == "let" {
+		return p.WhileLetExp()
+	}
+
 	cond := pr.Register(p.Exp())
 
 	pr.Register(p.SkipNewLines())
@@ -380,7 +661,120 @@ func (p *Parser) WhileExp() *ParseResult {
 	pr.RegisterAdvance()
 	p.Advance()
 
-	return pr.Success(NewWhileNode(cond, stmts))
+	elseCase := pr.Register(p.LoopElse())
+	if pr.Error != nil {
+		return pr
+	}
+
+	while := NewWhileNode(cond, stmts)
+	while.ElseCase = elseCase
+	return pr.Success(while)
+}
+
+// WhileLetExp parses the rest of 'while let <pattern> = <exp> { }', the
+// 'while' keyword is already consumed by WhileExp
+func (p *Parser) WhileLetExp() *ParseResult {
+	pr := NewParseResult()
+
+	pr.RegisterAdvance()
+	p.Advance()
+
+	pattern := pr.Register(p.BindingPattern())
+	if pr.Error != nil {
+		return pr
+	}
+
+	if p.CurrToken.Type != TTOp || p.CurrToken.Value != "=" {
+		return pr.Failure(
+			NewInvalidSyntaxError("Expected '='",
+			p.CurrToken.StartPos,
+			p.CurrToken.EndPos))
+	}
+
+	pr.RegisterAdvance()
+	p.Advance()
+	pr.Register(p.SkipNewLines())
+
+	value := pr.Register(p.Exp())
+	if pr.Error != nil {
+		return pr
+	}
+
+	pr.Register(p.SkipNewLines())
+
+	body := pr.Register(p.Block())
+	if pr.Error != nil {
+		return pr
+	}
+
+	elseCase := pr.Register(p.LoopElse())
+	if pr.Error != nil {
+		return pr
+	}
+
+	while := NewWhileLetNode(pattern, value, body)
+	while.ElseCase = elseCase
+	return pr.Success(while)
+}
+
+func (p *Parser) LoopExp() *ParseResult {
+	pr := NewParseResult()
+
+	if p.CurrToken.Type != TTKeyword || p.CurrToken.Value != "loop" {
+		return pr.Failure(
+			NewInvalidSyntaxError("Expected 'loop'",
+			p.CurrToken.StartPos,
+			p.CurrToken.EndPos))
+	}
+
+	pr.RegisterAdvance()
+	p.Advance()
+	pr.Register(p.SkipNewLines())
+
+	body := pr.Register(p.Block())
+	if pr.Error != nil {
+		return pr
+	}
+
+	return pr.Success(NewLoopNode(body))
+}
+
+func (p *Parser) DoWhileExp() *ParseResult {
+	pr := NewParseResult()
+
+	if p.CurrToken.Type != TTKeyword || p.CurrToken.Value != "do" {
+		return pr.Failure(
+			NewInvalidSyntaxError("Expected 'do'",
+			p.CurrToken.StartPos,
+			p.CurrToken.EndPos))
+	}
+
+	pr.RegisterAdvance()
+	p.Advance()
+	pr.Register(p.SkipNewLines())
+
+	body := pr.Register(p.Block())
+	if pr.Error != nil {
+		return pr
+	}
+
+	if p.CurrToken.Type != TTKeyword || p.CurrToken.Value != "while" {
+		return pr.Failure(
+			NewInvalidSyntaxError("Expected 'while'",
+			p.CurrToken.StartPos,
+			p.CurrToken.EndPos))
+	}
+
+	pr.RegisterAdvance()
+	p.Advance()
+	pr.Register(p.SkipNewLines())
+
+	cond := pr.Register(p.Exp())
+	if pr.Error != nil {
+		return pr
+	}
+
+	return pr.Success(NewDoWhileNode(body, cond))
 }
 
 func (p *Parser) ForExp() *ParseResult {
@@ -424,7 +818,9 @@ func (p *Parser) ForExp() *ParseResult {
 
 	pr.Register(p.SkipNewLines())
 
+	p.Colons++
 	from := pr.Register(p.Exp())
+	p.Colons--
 
 	if pr.Error != nil {
 		return pr
@@ -498,12 +894,19 @@ func (p *Parser) ForExp() *ParseResult {
 	pr.RegisterAdvance()
 	p.Advance()
 
-	pr.Register(p.SkipNewLines())
+	elseCase := pr.Register(p.LoopElse())
+	if pr.Error != nil {
+		return pr
+	}
 
-	return pr.Success(NewForNode(varName, from, to, by, body))
+	forNode := NewForNode(varName, from, to, by, body)
+	forNode.ElseCase = elseCase
+	return pr.Success(forNode)
 }
 
-func (p *Parser) EachExp() *ParseResult {
+// EachClause parses the 'each <iterable> as [index,] <pattern>' part shared
+// by each loops and comprehensions
+func (p *Parser) EachClause() *ParseResult {
 	pr := NewParseResult()
 
 	if p.CurrToken.Type != TTKeyword || p.CurrToken.Value != "each" {
@@ -541,27 +944,64 @@ func (p *Parser) EachExp() *ParseResult {
 
 	pr.Register(p.SkipNewLines())
 
-	if p.CurrToken.Type != TTId {
-		return pr.Failure(
-			NewInvalidSyntaxError("Expected identifier",
-			p.CurrToken.StartPos,
-			p.CurrToken.EndPos))
-	}
-
-	itemName := p.CurrToken
+	var indexName *Token = nil
 
-	pr.RegisterAdvance()
-	p.Advance()
-
-	if p.CurrToken.Type != TTOp || p.CurrToken.Value != "{" {
-		return pr.Failure(
-			NewInvalidSyntaxError("Expected '{'",
-			p.CurrToken.StartPos,
-			p.CurrToken.EndPos))
+	item := pr.Register(p.BindingPattern())
+	if pr.Error != nil {
+		return pr
 	}
 
-	pr.RegisterAdvance()
-	p.Advance()
+	if p.CurrToken.Type == TTOp && p.CurrToken.Value == "," {
+		index, ok := item.(*BindPatternNode)
+		if !ok {
+			return pr.Failure(
+				NewInvalidSyntaxError("Expected a name for the index",
+				p.CurrToken.StartPos,
+				p.CurrToken.EndPos))
+		}
+		indexName = index.NameToken
+
+		pr.RegisterAdvance()
+		p.Advance()
+
+		item = pr.Register(p.BindingPattern())
+		if pr.Error != nil {
+			return pr
+		}
+	}
+
+	return pr.Success(NewEachClauseNode(list, indexName, item))
+}
+
+func (p *Parser) EachExp() *ParseResult {
+	pr := NewParseResult()
+
+	var itemName *Token = nil
+	var itemPattern interface{} = nil
+
+	clause := pr.Register(p.EachClause())
+	if pr.Error != nil {
+		return pr
+	}
+
+	c := clause.(*EachClauseNode)
+	list, indexName, item := c.List, c.IndexName, c.ItemPattern
+
+	if b, ok := item.(*BindPatternNode); ok {
+		itemName = b.NameToken
+	} else {
+		itemPattern = item
+	}
+
+	if p.CurrToken.Type != TTOp || p.CurrToken.Value != "{" {
+		return pr.Failure(
+			NewInvalidSyntaxError("Expected '{'",
+			p.CurrToken.StartPos,
+			p.CurrToken.EndPos))
+	}
+
+	pr.RegisterAdvance()
+	p.Advance()
 
 	pr.Register(p.SkipNewLines())
 
@@ -583,9 +1023,14 @@ func (p *Parser) EachExp() *ParseResult {
 	pr.RegisterAdvance()
 	p.Advance()
 
-	pr.Register(p.SkipNewLines())
+	elseCase := pr.Register(p.LoopElse())
+	if pr.Error != nil {
+		return pr
+	}
 
-	return pr.Success(NewEachNode(list, itemName, body))
+	each := NewEachNode(list, indexName, itemName, itemPattern, body)
+	each.ElseCase = elseCase
+	return pr.Success(each)
 }
 
 func (p *Parser) FunDef() *ParseResult {
@@ -596,14 +1041,18 @@ func (p *Parser) FunDef() *ParseResult {
 			"Expected 'fun'", p.CurrToken.StartPos, p.CurrToken.EndPos))
 	}
 
+	startPos := p.CurrToken.StartPos
+
 	pr.RegisterAdvance()
 	p.Advance()
 
 	name := ""
-	args := []string{}
+	var nameToken *Token
+	args := []*ParamNode{}
 
 	if p.CurrToken.Type == TTId {
 		name = p.CurrToken.Value.(string)
+		nameToken = p.CurrToken
 
 		pr.RegisterAdvance()
 		p.Advance()
@@ -619,37 +1068,46 @@ func (p *Parser) FunDef() *ParseResult {
 
 	pr.Register(p.SkipNewLines())
 
-	if p.CurrToken.Type == TTId {
-		args = append(args, p.CurrToken.Value.(string))
-
-		pr.RegisterAdvance()
-		p.Advance()
+	if p.CurrToken.Type != TTOp || p.CurrToken.Value != ")" {
+		param := pr.Register(p.Param())
+		if pr.Error != nil {
+			return pr
+		}
+		args = append(args, param.(*ParamNode))
 
 		pr.Register(p.SkipNewLines())
 
 		for p.CurrToken.Type == TTOp && p.CurrToken.Value == "," {
-			pr.RegisterAdvance()
-			p.Advance()
-			pr.Register(p.SkipNewLines())
-
-			if p.CurrToken.Type != TTId {
+			if args[len(args) - 1].Variadic {
 				return pr.Failure(NewInvalidSyntaxError(
-					"Expected identifer",
+					"Expected ')' after a variadic parameter",
 					p.CurrToken.StartPos,
 					p.CurrToken.EndPos))
 			}
 
-			args = append(args, p.CurrToken.Value.(string))
-
 			pr.RegisterAdvance()
 			p.Advance()
 			pr.Register(p.SkipNewLines())
+
+			param := pr.Register(p.Param())
+			if pr.Error != nil {
+				return pr
+			}
+			args = append(args, param.(*ParamNode))
+
+			pr.Register(p.SkipNewLines())
 		}
 	}
 
 	if p.CurrToken.Type == TTOp && p.CurrToken.Value == ")" {
 		pr.RegisterAdvance()
 		p.Advance()
+
+		returnType := pr.Register(p.OptionalType("->"))
+		if pr.Error != nil {
+			return pr
+		}
+
 		pr.Register(p.SkipNewLines())
 
 		if p.CurrToken.Type == TTOp && p.CurrToken.Value == "=" {			
@@ -663,13 +1121,24 @@ func (p *Parser) FunDef() *ParseResult {
 				return pr
 			}
 
-			return pr.Success(NewFunDefNode(name, args, body, true))
+			funDef := NewFunDefNode(name, args, body, true, false)
+			funDef.ReturnType, _ = returnType.(*TypeNode)
+			funDef.StartPos, funDef.EndPos = startPos, p.Tokens[p.TokenIndex - 1].EndPos
+			funDef.NameToken = nameToken
+			return pr.Success(funDef)
 		} else if p.CurrToken.Type == TTOp && p.CurrToken.Value == "{" {
 			pr.RegisterAdvance()
 			p.Advance()
 			pr.Register(p.SkipNewLines())
-			
+
+			// Loop labels can't cross a function boundary
+			loopLabels := p.LoopLabels
+			p.LoopLabels = nil
+			p.FunYields = append(p.FunYields, false)
 			stmts := pr.Register(p.Statements())
+			isGenerator := p.FunYields[len(p.FunYields) - 1]
+			p.FunYields = p.FunYields[:len(p.FunYields) - 1]
+			p.LoopLabels = loopLabels
 
 			if pr.Error != nil {
 				return pr
@@ -684,10 +1153,15 @@ func (p *Parser) FunDef() *ParseResult {
 					p.CurrToken.EndPos))
 			}
 
+			endPos := p.CurrToken.EndPos
 			pr.RegisterAdvance()
 			p.Advance()
 
-			return pr.Success(NewFunDefNode(name, args, stmts, false))
+			funDef := NewFunDefNode(name, args, stmts, false, isGenerator)
+			funDef.ReturnType, _ = returnType.(*TypeNode)
+			funDef.StartPos, funDef.EndPos = startPos, endPos
+			funDef.NameToken = nameToken
+			return pr.Success(funDef)
 		}
 
 		return pr.Failure(NewInvalidSyntaxError(
@@ -698,149 +1172,1106 @@ func (p *Parser) FunDef() *ParseResult {
 		"Expected identifier or ')'", p.CurrToken.StartPos, p.CurrToken.EndPos))
 }
 
+func (p *Parser) Param() *ParseResult {
+	pr := NewParseResult()
+
+	startPos := p.CurrToken.StartPos
+
+	if p.CurrToken.Type == TTOp && p.CurrToken.Value == "..." {
+		pr.RegisterAdvance()
+		p.Advance()
+
+		if p.CurrToken.Type != TTId {
+			return pr.Failure(NewInvalidSyntaxError(
+				"Expected identifier after '...'", p.CurrToken.StartPos, p.CurrToken.EndPos))
+		}
+
+		name := p.CurrToken.Value.(string)
+		startPos, endPos := p.CurrToken.StartPos, p.CurrToken.EndPos
+
+		pr.RegisterAdvance()
+		p.Advance()
+
+		typ := pr.Register(p.OptionalType(":"))
+		if pr.Error != nil {
+			return pr
+		}
+
+		param := NewParamNode(name, nil, nil, "", true)
+		param.Type, _ = typ.(*TypeNode)
+		param.StartPos, param.EndPos = startPos, endPos
+
+		return pr.Success(param)
+	}
+
+	pattern := pr.Register(p.BindingPattern())
+	if pr.Error != nil {
+		return pr
+	}
+	endPos := p.Tokens[p.TokenIndex - 1].EndPos
+
+	name := fmt.Sprintf("%v", pattern)
+	if b, ok := pattern.(*BindPatternNode); ok {
+		name = b.NameToken.Value.(string)
+		pattern = nil
+	}
+
+	pr.Register(p.SkipNewLines())
+
+	typ := pr.Register(p.OptionalType(":"))
+	if pr.Error != nil {
+		return pr
+	}
+
+	param := NewParamNode(name, pattern, nil, "", false)
+	param.Type, _ = typ.(*TypeNode)
+	param.StartPos, param.EndPos = startPos, endPos
+
+	if p.CurrToken.Type == TTOp && p.CurrToken.Value == "=" {
+		pr.RegisterAdvance()
+		p.Advance()
+		pr.Register(p.SkipNewLines())
+
+		startIndex := p.TokenIndex
+
+		def := pr.Register(p.Exp())
+		if pr.Error != nil {
+			return pr
+		}
+
+		param.Default = def
+		param.DefaultText = p.SourceText(startIndex, p.TokenIndex)
+	}
+
+	return pr.Success(param)
+}
+
+var TypeNames = []string{"any", "num", "str", "list", "map", "fun", "null", "range", "iterator"}
+
+// OptionalType parses a type annotation if the current token is the given
+// separator (':' or '->'), e.g. 'num', 'list[str]' or 'map[num]?'
+func (p *Parser) OptionalType(sep string) *ParseResult {
+	pr := NewParseResult()
+
+	if p.CurrToken.Type != TTOp || p.CurrToken.Value != sep {
+		return pr.Success(nil)
+	}
+
+	pr.RegisterAdvance()
+	p.Advance()
+
+	return p.Type()
+}
+
+func (p *Parser) Type() *ParseResult {
+	pr := NewParseResult()
+	t := p.CurrToken
+
+	if t.Type != TTId && t.Type != TTNull && (t.Type != TTKeyword || t.Value != "fun") {
+		return pr.Failure(NewInvalidSyntaxError("Expected a type", t.StartPos, t.EndPos))
+	}
+
+	name := t.Value.(string)
+	if !Contains(TypeNames, name) {
+		return pr.Failure(NewInvalidSyntaxError(fmt.Sprintf("Unknown type '%v'", name), t.StartPos, t.EndPos))
+	}
+
+	pr.RegisterAdvance()
+	p.Advance()
+
+	typ := NewTypeNode(name, []*TypeNode{}, t.StartPos, t.EndPos)
+
+	if p.CurrToken.Type == TTOp && p.CurrToken.Value == "[" && (name == "list" || name == "map" || name == "iterator") {
+		pr.RegisterAdvance()
+		p.Advance()
+
+		arg := pr.Register(p.Type())
+		if pr.Error != nil {
+			return pr
+		}
+		typ.Args = append(typ.Args, arg.(*TypeNode))
+
+		if p.CurrToken.Type != TTOp || p.CurrToken.Value != "]" {
+			return pr.Failure(NewInvalidSyntaxError("Expected ']'", p.CurrToken.StartPos, p.CurrToken.EndPos))
+		}
+		typ.EndPos = p.CurrToken.EndPos
+
+		pr.RegisterAdvance()
+		p.Advance()
+	}
+
+	// A '?' followed by an expression is a ternary operator after `x is T`
+	if p.CurrToken.Type == TTOp && p.CurrToken.Value == "?" && EndsType(p.PeekToken(1)) {
+		typ.Nullable = true
+		typ.EndPos = p.CurrToken.EndPos
+
+		pr.RegisterAdvance()
+		p.Advance()
+	}
+
+	return pr.Success(typ)
+}
+
+// EndsType reports whether a token can follow a type annotation, which tells
+// a nullable type's '?' from a ternary operator
+func EndsType(t *Token) bool {
+	if t.Type == TTNewLine || t.Type == TTEOF {
+		return true
+	}
+	return t.Type == TTOp && Contains([]string{",", ")", "]", "}", "{", "=", "=>"}, t.Value.(string))
+}
+
+func (p *Parser) SourceText(from, to int) string {
+	for to > from && p.Tokens[to - 1].Type == TTNewLine {
+		to -= 1
+	}
+
+	if to <= from {
+		return ""
+	}
+
+	start := p.Tokens[from].StartPos
+	end := p.Tokens[to - 1].EndPos
+
+	if start.FileText == "" || end.Index > len(start.FileText) {
+		return "..."
+	}
+
+	return start.FileText[start.Index:end.Index]
+}
+
 func (p *Parser) ListExp() *ParseResult {
 	pr := NewParseResult()
 
 	el := []interface{}{}
 
-	if p.CurrToken.Type != TTOp || p.CurrToken.Value != "[" {
-		return pr.Failure(NewInvalidSyntaxError(
-			"Expected '['", p.CurrToken.StartPos, p.CurrToken.EndPos))
+	if p.CurrToken.Type != TTOp || p.CurrToken.Value != "[" {
+		return pr.Failure(NewInvalidSyntaxError(
+			"Expected '['", p.CurrToken.StartPos, p.CurrToken.EndPos))
+	}
+
+	startPos := p.CurrToken.StartPos
+
+	pr.RegisterAdvance()
+	p.Advance()
+
+	pr.Register(p.SkipNewLines())
+
+	if p.CurrToken.Type == TTOp && p.CurrToken.Value == "]" {
+		list := NewListNode(el)
+		list.StartPos, list.EndPos = startPos, p.CurrToken.EndPos
+		pr.RegisterAdvance()
+		p.Advance()
+		return pr.Success(list)
+	}
+
+	el = append(el, pr.Register(p.Exp()))
+	if pr.Error != nil {
+		return pr
+	}
+	pr.Register(p.SkipNewLines())
+
+	if p.CurrToken.Type == TTKeyword && p.CurrToken.Value == "each" {
+		clauses := pr.Register(p.ComprehensionClauses())
+		if pr.Error != nil {
+			return pr
+		}
+
+		if p.CurrToken.Type != TTOp || p.CurrToken.Value != "]" {
+			return pr.Failure(NewInvalidSyntaxError(
+				"Expected ']'", p.CurrToken.StartPos, p.CurrToken.EndPos))
+		}
+
+		endPos := p.CurrToken.EndPos
+		pr.RegisterAdvance()
+		p.Advance()
+
+		return pr.Success(NewComprehensionNode(nil, el[0], clauses.([]interface{}), startPos, endPos))
+	}
+
+	for p.CurrToken.Type == TTOp && p.CurrToken.Value == "," {
+		pr.RegisterAdvance()
+		p.Advance()
+		pr.Register(p.SkipNewLines())
+
+		el = append(el, pr.Register(p.Exp()))
+		if pr.Error != nil {
+			return pr
+		}
+		pr.Register(p.SkipNewLines())
+	}
+
+	if p.CurrToken.Type != TTOp && p.CurrToken.Value != "]" {
+		return pr.Failure(NewInvalidSyntaxError(
+			"Expected ']'",
+			p.CurrToken.StartPos,
+			p.CurrToken.EndPos))
+	}
+
+	list := NewListNode(el)
+	list.StartPos, list.EndPos = startPos, p.CurrToken.EndPos
+	pr.RegisterAdvance()
+	p.Advance()
+
+	return pr.Success(list)
+}
+
+func (p *Parser) MapExp() *ParseResult {
+	pr := NewParseResult()
+
+	keys := []string{}
+	values := []interface{}{}
+
+	if p.CurrToken.Type != TTOp || p.CurrToken.Value != "{" {
+		return pr.Failure(NewInvalidSyntaxError(
+			"Expected '{'", p.CurrToken.StartPos, p.CurrToken.EndPos))
+	}
+
+	startPos := p.CurrToken.StartPos
+	pr.RegisterAdvance()
+	p.Advance()
+
+	pr.Register(p.SkipNewLines())
+
+	if p.CurrToken.Type != TTOp || p.CurrToken.Value != "}" {
+		res := p.MapComprehension(startPos)
+		if res.Error != nil || res.Node != nil {
+			node := pr.Register(res)
+			return pr.Success(node)
+		}
+		p.Reverse(res.AdvanceCount)
+	}
+
+	for p.CurrToken.Type != TTOp || p.CurrToken.Value != "}" {
+		if len(keys) > 0 {
+			if p.CurrToken.Type != TTOp || p.CurrToken.Value != "," {
+				return pr.Failure(NewInvalidSyntaxError(
+					"Expected ',' or '}'", p.CurrToken.StartPos, p.CurrToken.EndPos))
+			}
+
+			pr.RegisterAdvance()
+			p.Advance()
+			pr.Register(p.SkipNewLines())
+		}
+
+		if p.CurrToken.Type != TTStr && p.CurrToken.Type != TTId {
+			return pr.Failure(NewInvalidSyntaxError(
+				"Expected a string or an identifier as a map key", p.CurrToken.StartPos, p.CurrToken.EndPos))
+		}
+
+		keyToken := p.CurrToken
+		key := keyToken.Value.(string)
+
+		pr.RegisterAdvance()
+		p.Advance()
+		pr.Register(p.SkipNewLines())
+
+		if p.CurrToken.Type != TTOp || p.CurrToken.Value != ":" {
+			return pr.Failure(NewInvalidSyntaxError(
+				"Expected ':'", p.CurrToken.StartPos, p.CurrToken.EndPos))
+		}
+
+		pr.RegisterAdvance()
+		p.Advance()
+		pr.Register(p.SkipNewLines())
+
+		value := pr.Register(p.Exp())
+		if pr.Error != nil {
+			return pr
+		}
+		pr.Register(p.SkipNewLines())
+
+		keys = append(keys, key)
+		values = append(values, value)
+	}
+
+	m := NewMapNode(keys, values)
+	m.StartPos, m.EndPos = startPos, p.CurrToken.EndPos
+	pr.RegisterAdvance()
+	p.Advance()
+
+	return pr.Success(m)
+}
+
+// MapComprehension parses {key: value each ...} which builds the map from the
+// comprehension, the key is any expression instead of a literal name. It
+// succeeds without a node when there's no 'each' after the first value, so
+// the map is parsed as a literal instead
+func (p *Parser) MapComprehension(startPos *Position) *ParseResult {
+	pr := NewParseResult()
+
+	p.Colons++
+	key := pr.Register(p.Exp())
+	p.Colons--
+	if pr.Error != nil || p.CurrToken.Type != TTOp || p.CurrToken.Value != ":" {
+		pr.Error = nil
+		return pr
+	}
+
+	pr.RegisterAdvance()
+	p.Advance()
+	pr.Register(p.SkipNewLines())
+
+	value := pr.Register(p.Exp())
+	pr.Register(p.SkipNewLines())
+	if pr.Error != nil || p.CurrToken.Type != TTKeyword || p.CurrToken.Value != "each" {
+		pr.Error = nil
+		return pr
+	}
+
+	clauses := pr.Register(p.ComprehensionClauses())
+	if pr.Error != nil {
+		return pr
+	}
+
+	if p.CurrToken.Type != TTOp || p.CurrToken.Value != "}" {
+		return pr.Failure(NewInvalidSyntaxError(
+			"Expected '}'", p.CurrToken.StartPos, p.CurrToken.EndPos))
+	}
+
+	endPos := p.CurrToken.EndPos
+	pr.RegisterAdvance()
+	p.Advance()
+
+	return pr.Success(NewComprehensionNode(key, value, clauses.([]interface{}), startPos, endPos))
+}
+
+// ComprehensionClauses parses the 'each ... as ...' and 'if ...' clauses
+// of a comprehension, conditions are kept as plain expression nodes
+func (p *Parser) ComprehensionClauses() *ParseResult {
+	pr := NewParseResult()
+	clauses := []interface{}{}
+
+	for p.CurrToken.Type == TTKeyword && (p.CurrToken.Value == "each" || p.CurrToken.Value == "if") {
+		if p.CurrToken.Value == "each" {
+			clause := pr.Register(p.EachClause())
+			if pr.Error != nil {
+				return pr
+			}
+			clauses = append(clauses, clause)
+		} else {
+			if len(clauses) == 0 {
+				return pr.Failure(NewInvalidSyntaxError(
+					"Expected 'each'", p.CurrToken.StartPos, p.CurrToken.EndPos))
+			}
+
+			pr.RegisterAdvance()
+			p.Advance()
+			pr.Register(p.SkipNewLines())
+
+			cond := pr.Register(p.Exp())
+			if pr.Error != nil {
+				return pr
+			}
+			clauses = append(clauses, cond)
+		}
+		pr.Register(p.SkipNewLines())
+	}
+
+	return pr.Success(clauses)
+}
+
+func (p *Parser) Block() *ParseResult {
+	pr := NewParseResult()
+
+	if p.CurrToken.Type != TTOp || p.CurrToken.Value != "{" {
+		return pr.Failure(
+			NewInvalidSyntaxError("Expected '{'",
+			p.CurrToken.StartPos,
+			p.CurrToken.EndPos))
+	}
+
+	pr.RegisterAdvance()
+	p.Advance()
+
+	pr.Register(p.SkipNewLines())
+
+	stmts := pr.Register(p.Statements())
+	if pr.Error != nil {
+		return pr
+	}
+
+	pr.Register(p.SkipNewLines())
+
+	if p.CurrToken.Type != TTOp || p.CurrToken.Value != "}" {
+		return pr.Failure(
+			NewInvalidSyntaxError("Expected '}'",
+			p.CurrToken.StartPos,
+			p.CurrToken.EndPos))
+	}
+
+	pr.RegisterAdvance()
+	p.Advance()
+
+	return pr.Success(stmts)
+}
+
+func (p *Parser) Pattern() *ParseResult {
+	pr := NewParseResult()
+	t := p.CurrToken
+
+	if t.Type == TTId {
+		pr.RegisterAdvance()
+		p.Advance()
+
+		if t.Value == "_" {
+			return pr.Success(NewWildcardPatternNode(t))
+		}
+		if t.Value == "true" || t.Value == "false" {
+			return pr.Success(NewValuePatternNode(NewVarAccessNode(t)))
+		}
+		return pr.Success(NewBindPatternNode(t))
+	} else if t.Type == TTNum {
+		pr.RegisterAdvance()
+		p.Advance()
+		return pr.Success(NewValuePatternNode(NewNumberNode(t)))
+	} else if t.Type == TTOp && t.Value == "-" {
+		pr.RegisterAdvance()
+		p.Advance()
+
+		if p.CurrToken.Type != TTNum {
+			return pr.Failure(NewInvalidSyntaxError(
+				"Expected a number", p.CurrToken.StartPos, p.CurrToken.EndPos))
+		}
+
+		num := NewNumberNode(p.CurrToken)
+
+		pr.RegisterAdvance()
+		p.Advance()
+
+		return pr.Success(NewValuePatternNode(NewUnaryOpNode(t, num)))
+	} else if t.Type == TTStr {
+		pr.RegisterAdvance()
+		p.Advance()
+		return pr.Success(NewValuePatternNode(NewStringNode(t)))
+	} else if t.Type == TTNull {
+		pr.RegisterAdvance()
+		p.Advance()
+		return pr.Success(NewValuePatternNode(NewNullNode(t)))
+	} else if t.Type == TTOp && t.Value == "[" {
+		listPattern := pr.Register(p.ListPattern(p.Pattern))
+		if pr.Error != nil {
+			return pr
+		}
+		return pr.Success(listPattern)
+	} else if t.Type == TTOp && t.Value == "{" {
+		mapPattern := pr.Register(p.MapPattern(p.Pattern))
+		if pr.Error != nil {
+			return pr
+		}
+		return pr.Success(mapPattern)
+	}
+
+	return pr.Failure(NewInvalidSyntaxError(
+		"Expected a pattern", t.StartPos, t.EndPos))
+}
+
+func (p *Parser) BindingPattern() *ParseResult {
+	pr := NewParseResult()
+	t := p.CurrToken
+
+	if t.Type == TTId {
+		pr.RegisterAdvance()
+		p.Advance()
+
+		if t.Value == "_" {
+			return pr.Success(NewWildcardPatternNode(t))
+		}
+		return pr.Success(NewBindPatternNode(t))
+	} else if t.Type == TTOp && t.Value == "[" {
+		listPattern := pr.Register(p.ListPattern(p.BindingPattern))
+		if pr.Error != nil {
+			return pr
+		}
+		return pr.Success(listPattern)
+	} else if t.Type == TTOp && t.Value == "{" {
+		mapPattern := pr.Register(p.MapPattern(p.BindingPattern))
+		if pr.Error != nil {
+			return pr
+		}
+		return pr.Success(mapPattern)
+	}
+
+	return pr.Failure(NewInvalidSyntaxError(
+		"Expected identifier, '[' or '{'", t.StartPos, t.EndPos))
+}
+
+func (p *Parser) AssignTarget() *ParseResult {
+	pr := NewParseResult()
+	t := p.CurrToken
+
+	if t.Type == TTId && t.Value == "_" {
+		pr.RegisterAdvance()
+		p.Advance()
+		return pr.Success(NewWildcardPatternNode(t))
+	} else if t.Type == TTOp && t.Value == "[" {
+		listPattern := pr.Register(p.ListPattern(p.AssignTarget))
+		if pr.Error != nil {
+			return pr
+		}
+		return pr.Success(listPattern)
+	} else if t.Type == TTOp && t.Value == "{" {
+		mapPattern := pr.Register(p.MapPattern(p.AssignTarget))
+		if pr.Error != nil {
+			return pr
+		}
+		return pr.Success(mapPattern)
+	}
+
+	node := pr.Register(p.Postfix())
+	if pr.Error != nil {
+		return pr
+	}
+
+	if access, ok := node.(*VarAccessNode); ok {
+		return pr.Success(NewBindPatternNode(access.NameToken))
+	}
+	if el, ok := node.(*ElementAccessNode); ok && el.To == nil {
+		return pr.Success(el)
+	}
+
+	return pr.Failure(NewInvalidSyntaxError(
+		"Expected a variable or an element to assign to", t.StartPos, t.EndPos))
+}
+
+func (p *Parser) AssignTargets() *ParseResult {
+	pr := NewParseResult()
+
+	targets := []interface{}{}
+	var rest *Token = nil
+
+	for {
+		if p.CurrToken.Type == TTOp && p.CurrToken.Value == "..." {
+			pr.RegisterAdvance()
+			p.Advance()
+
+			if p.CurrToken.Type != TTId {
+				return pr.Failure(NewInvalidSyntaxError(
+					"Expected identifier after '...'", p.CurrToken.StartPos, p.CurrToken.EndPos))
+			}
+
+			rest = p.CurrToken
+
+			pr.RegisterAdvance()
+			p.Advance()
+			break
+		}
+
+		target := pr.Register(p.AssignTarget())
+		if pr.Error != nil {
+			return pr
+		}
+		targets = append(targets, target)
+
+		if p.CurrToken.Type != TTOp || p.CurrToken.Value != "," {
+			break
+		}
+
+		pr.RegisterAdvance()
+		p.Advance()
+	}
+
+	if p.CurrToken.Type != TTOp || p.CurrToken.Value != "=" {
+		return pr.Failure(NewInvalidSyntaxError(
+			"Expected '='", p.CurrToken.StartPos, p.CurrToken.EndPos))
+	}
+
+	if len(targets) == 1 && rest == nil {
+		return pr.Success(targets[0])
+	}
+
+	return pr.Success(NewListPatternNode(targets, rest))
+}
+
+func (p *Parser) ExpList() *ParseResult {
+	pr := NewParseResult()
+
+	exp := pr.Register(p.Exp())
+	if pr.Error != nil {
+		return pr
+	}
+
+	if p.CurrToken.Type != TTOp || p.CurrToken.Value != "," {
+		return pr.Success(exp)
+	}
+
+	el := []interface{}{exp}
+
+	for p.CurrToken.Type == TTOp && p.CurrToken.Value == "," {
+		pr.RegisterAdvance()
+		p.Advance()
+		pr.Register(p.SkipNewLines())
+
+		el = append(el, pr.Register(p.Exp()))
+		if pr.Error != nil {
+			return pr
+		}
+	}
+
+	return pr.Success(NewListNode(el))
+}
+
+func (p *Parser) ListPattern(ef func() *ParseResult) *ParseResult {
+	pr := NewParseResult()
+
+	el := []interface{}{}
+	var rest *Token = nil
+
+	if p.CurrToken.Type != TTOp || p.CurrToken.Value != "[" {
+		return pr.Failure(NewInvalidSyntaxError(
+			"Expected '['", p.CurrToken.StartPos, p.CurrToken.EndPos))
+	}
+
+	pr.RegisterAdvance()
+	p.Advance()
+
+	pr.Register(p.SkipNewLines())
+
+	for p.CurrToken.Type != TTOp || p.CurrToken.Value != "]" {
+		if len(el) > 0 || rest != nil {
+			if rest != nil || p.CurrToken.Type != TTOp || p.CurrToken.Value != "," {
+				return pr.Failure(NewInvalidSyntaxError(
+					"Expected ']'", p.CurrToken.StartPos, p.CurrToken.EndPos))
+			}
+
+			pr.RegisterAdvance()
+			p.Advance()
+			pr.Register(p.SkipNewLines())
+		}
+
+		if p.CurrToken.Type == TTOp && p.CurrToken.Value == "..." {
+			pr.RegisterAdvance()
+			p.Advance()
+
+			if p.CurrToken.Type != TTId {
+				return pr.Failure(NewInvalidSyntaxError(
+					"Expected identifier after '...'", p.CurrToken.StartPos, p.CurrToken.EndPos))
+			}
+
+			rest = p.CurrToken
+
+			pr.RegisterAdvance()
+			p.Advance()
+			pr.Register(p.SkipNewLines())
+			continue
+		}
+
+		pattern := pr.Register(ef())
+		if pr.Error != nil {
+			return pr
+		}
+		pr.Register(p.SkipNewLines())
+
+		el = append(el, pattern)
+	}
+
+	pr.RegisterAdvance()
+	p.Advance()
+
+	return pr.Success(NewListPatternNode(el, rest))
+}
+
+func (p *Parser) MapPattern(ef func() *ParseResult) *ParseResult {
+	pr := NewParseResult()
+
+	keys := []string{}
+	values := []interface{}{}
+
+	if p.CurrToken.Type != TTOp || p.CurrToken.Value != "{" {
+		return pr.Failure(NewInvalidSyntaxError(
+			"Expected '{'", p.CurrToken.StartPos, p.CurrToken.EndPos))
+	}
+
+	pr.RegisterAdvance()
+	p.Advance()
+
+	pr.Register(p.SkipNewLines())
+
+	for p.CurrToken.Type != TTOp || p.CurrToken.Value != "}" {
+		if len(keys) > 0 {
+			if p.CurrToken.Type != TTOp || p.CurrToken.Value != "," {
+				return pr.Failure(NewInvalidSyntaxError(
+					"Expected ',' or '}'", p.CurrToken.StartPos, p.CurrToken.EndPos))
+			}
+
+			pr.RegisterAdvance()
+			p.Advance()
+			pr.Register(p.SkipNewLines())
+		}
+
+		keyToken := p.CurrToken
+		if keyToken.Type != TTStr && keyToken.Type != TTId {
+			return pr.Failure(NewInvalidSyntaxError(
+				"Expected a string or an identifier as a map key", keyToken.StartPos, keyToken.EndPos))
+		}
+
+		pr.RegisterAdvance()
+		p.Advance()
+		pr.Register(p.SkipNewLines())
+
+		var pattern interface{}
+
+		if p.CurrToken.Type == TTOp && p.CurrToken.Value == ":" {
+			pr.RegisterAdvance()
+			p.Advance()
+			pr.Register(p.SkipNewLines())
+
+			pattern = pr.Register(ef())
+			if pr.Error != nil {
+				return pr
+			}
+			pr.Register(p.SkipNewLines())
+		} else if keyToken.Type == TTId {
+			pattern = NewBindPatternNode(keyToken)
+		} else {
+			return pr.Failure(NewInvalidSyntaxError(
+				"Expected ':'", p.CurrToken.StartPos, p.CurrToken.EndPos))
+		}
+
+		keys = append(keys, keyToken.Value.(string))
+		values = append(values, pattern)
+	}
+
+	pr.RegisterAdvance()
+	p.Advance()
+
+	return pr.Success(NewMapPatternNode(keys, values))
+}
+
+func (p *Parser) MatchExp() *ParseResult {
+	pr := NewParseResult()
+	cases := []*MatchCase{}
+
+	if p.CurrToken.Type != TTKeyword || p.CurrToken.Value != "match" {
+		return pr.Failure(
+			NewInvalidSyntaxError("Expected 'match'",
+			p.CurrToken.StartPos,
+			p.CurrToken.EndPos))
+	}
+
+	matchToken := p.CurrToken
+
+	pr.RegisterAdvance()
+	p.Advance()
+
+	pr.Register(p.SkipNewLines())
+
+	value := pr.Register(p.Exp())
+	if pr.Error != nil {
+		return pr
+	}
+
+	pr.Register(p.SkipNewLines())
+
+	if p.CurrToken.Type != TTOp || p.CurrToken.Value != "{" {
+		return pr.Failure(
+			NewInvalidSyntaxError("Expected '{'",
+			p.CurrToken.StartPos,
+			p.CurrToken.EndPos))
+	}
+
+	pr.RegisterAdvance()
+	p.Advance()
+
+	pr.Register(p.SkipNewLines())
+
+	for p.CurrToken.Type != TTOp || p.CurrToken.Value != "}" {
+		pattern := pr.Register(p.Pattern())
+		if pr.Error != nil {
+			return pr
+		}
+
+		pr.Register(p.SkipNewLines())
+
+		var guard interface{} = nil
+
+		if p.CurrToken.Type == TTKeyword && p.CurrToken.Value == "if" {
+			pr.RegisterAdvance()
+			p.Advance()
+
+			guard = pr.Register(p.Exp())
+			if pr.Error != nil {
+				return pr
+			}
+
+			pr.Register(p.SkipNewLines())
+		}
+
+		if p.CurrToken.Type != TTOp || p.CurrToken.Value != "=>" {
+			return pr.Failure(
+				NewInvalidSyntaxError("Expected '=>'",
+				p.CurrToken.StartPos,
+				p.CurrToken.EndPos))
+		}
+
+		pr.RegisterAdvance()
+		p.Advance()
+
+		pr.Register(p.SkipNewLines())
+
+		var body interface{}
+
+		if p.CurrToken.Type == TTOp && p.CurrToken.Value == "{" {
+			body = pr.Register(p.Block())
+		} else {
+			body = pr.Register(p.Statement())
+		}
+		if pr.Error != nil {
+			return pr
+		}
+
+		cases = append(cases, &MatchCase{
+			Pattern: pattern,
+			Guard: guard,
+			Body: body,
+		})
+
+		pr.Register(p.SkipNewLines())
+
+		if p.CurrToken.Type == TTOp && p.CurrToken.Value == "," {
+			pr.RegisterAdvance()
+			p.Advance()
+
+			pr.Register(p.SkipNewLines())
+		}
+	}
+
+	pr.RegisterAdvance()
+	p.Advance()
+
+	return pr.Success(NewMatchNode(matchToken, value, cases))
+}
+
+func (p *Parser) Arg() *ParseResult {
+	pr := NewParseResult()
+
+	if p.CurrToken.Type == TTOp && p.CurrToken.Value == "..." {
+		pr.RegisterAdvance()
+		p.Advance()
+
+		exp := pr.Register(p.Exp())
+		if pr.Error != nil {
+			return pr
+		}
+
+		return pr.Success(NewSpreadNode(exp))
+	}
+
+	if p.CurrToken.Type == TTId && p.TokenIndex + 1 < len(p.Tokens) {
+		next := p.Tokens[p.TokenIndex + 1]
+
+		if next.Type == TTOp && next.Value == ":" {
+			name := p.CurrToken
+
+			pr.RegisterAdvance()
+			p.Advance()
+			pr.RegisterAdvance()
+			p.Advance()
+			pr.Register(p.SkipNewLines())
+
+			exp := pr.Register(p.Exp())
+			if pr.Error != nil {
+				return pr
+			}
+
+			return pr.Success(NewKeywordArgNode(name, exp))
+		}
 	}
 
-	pr.RegisterAdvance()
-	p.Advance()
+	exp := pr.Register(p.Exp())
+	if pr.Error != nil {
+		return pr
+	}
 
-	pr.Register(p.SkipNewLines())
+	return pr.Success(exp)
+}
 
-	if p.CurrToken.Type == TTOp && p.CurrToken.Value == "]" {
-		pr.RegisterAdvance()
-		p.Advance()
-		return pr.Success(NewListNode(el))
-	}
+func (p *Parser) Call() *ParseResult {
+	pr := NewParseResult()
+	node := pr.Register(p.Postfix())
 
-	el = append(el, pr.Register(p.Exp()))
 	if pr.Error != nil {
 		return pr
 	}
-	pr.Register(p.SkipNewLines())
 
-	for p.CurrToken.Type == TTOp && p.CurrToken.Value == "," {
+	if p.CurrToken.Type == TTOp && (p.CurrToken.Value == "=" || Contains(CompoundAssignOps, p.CurrToken.Value)) {
+		op := p.CurrToken
+
+		access, isVar := node.(*VarAccessNode)
+		el, isElement := node.(*ElementAccessNode)
+		if !isVar && (!isElement || el.To != nil || el.Optional || el.Chained) {
+			return pr.Failure(NewInvalidSyntaxError(
+				fmt.Sprintf("Can't assign to this expression using '%v'", op.Value),
+				op.StartPos,
+				op.EndPos))
+		}
+
 		pr.RegisterAdvance()
 		p.Advance()
 		pr.Register(p.SkipNewLines())
 
-		el = append(el, pr.Register(p.Exp()))
+		exp := pr.Register(p.Exp())
 		if pr.Error != nil {
 			return pr
 		}
-		pr.Register(p.SkipNewLines())
-	}
 
-	if p.CurrToken.Type != TTOp && p.CurrToken.Value != "]" {
-		return pr.Failure(NewInvalidSyntaxError(
-			"Expected ']'",
-			p.CurrToken.StartPos,
-			p.CurrToken.EndPos))
+		if op.Value != "=" {
+			return pr.Success(NewCompoundAssignNode(node, op, exp))
+		}
+		if isVar {
+			return pr.Success(NewVarAssignNode(access.NameToken, exp))
+		}
+		return pr.Success(NewElementAssignNode(el.Node, el.Index, exp, el.StartPos, el.EndPos))
 	}
 
-	pr.RegisterAdvance()
-	p.Advance()
-
-	return pr.Success(NewListNode(el))
+	return pr.Success(node)
 }
 
-func (p *Parser) Call() *ParseResult {
+func (p *Parser) Postfix() *ParseResult {
 	pr := NewParseResult()
-	atom := pr.Register(p.Atom())
+	startPos := p.CurrToken.StartPos
+	node := pr.Register(p.Atom())
 
 	if pr.Error != nil {
 		return pr
 	}
 
-	if p.CurrToken.Type == TTOp && p.CurrToken.Value == "(" {
-		pr.RegisterAdvance()
-		p.Advance()
-		pr.Register(p.SkipNewLines())
+	// A '?.' or '?[' link skips the rest of the chain when it's read from a
+	// null, the links after it are chained to it
+	optional, chained := false, false
 
-		args := []interface{}{}
+	for p.CurrToken.Type == TTOp {
+		link := p.CurrToken.Value
 
-		if p.CurrToken.Type == TTOp && p.CurrToken.Value == ")" {
+		if link == "?[" && p.TernaryAhead() {
+			p.SplitToken()
+			break
+		}
+		chained = chained || optional
+		optional = link == "?." || link == "?["
+		if link == "?." {
 			pr.RegisterAdvance()
 			p.Advance()
-			return pr.Success(NewFunCallNode(atom, args))
-		} else {
-			args = append(args, pr.Register(p.Exp()))
+
+			link = "."
+			if p.CurrToken.Type == TTOp && p.CurrToken.Value == "(" {
+				link = "("
+			}
+		} else if link == "." || link == "?[" {
+			pr.RegisterAdvance()
+			p.Advance()
+		}
+
+		if link == "(" {
+			pr.RegisterAdvance()
+			p.Advance()
+			pr.Register(p.SkipNewLines())
+
+			args := []interface{}{}
+			keywords := false
+
+			for p.CurrToken.Type != TTOp || p.CurrToken.Value != ")" {
+				if len(args) > 0 {
+					if p.CurrToken.Type != TTOp || p.CurrToken.Value != "," {
+						return pr.Failure(NewInvalidSyntaxError(
+							"Expected ',' or ')'",
+							p.CurrToken.StartPos,
+							p.CurrToken.EndPos))
+					}
+
+					pr.RegisterAdvance()
+					p.Advance()
+					pr.Register(p.SkipNewLines())
+				}
+
+				argToken := p.CurrToken
+				arg := pr.Register(p.Arg())
+				if pr.Error != nil {
+					return pr
+				}
+				_, isKeyword := arg.(*KeywordArgNode)
+				_, isSpread := arg.(*SpreadNode)
+				if keywords && !isKeyword && !isSpread {
+					return pr.Failure(NewInvalidSyntaxError(
+						"Positional argument follows keyword argument",
+						argToken.StartPos,
+						argToken.EndPos))
+				}
+				keywords = keywords || isKeyword
+				args = append(args, arg)
+				pr.Register(p.SkipNewLines())
+			}
+
+			pr.RegisterAdvance()
+			p.Advance()
+
+			call := NewFunCallNode(node, args)
+			call.Optional, call.Chained = optional, chained
+			node = call
+		} else if link == "[" || link == "?[" {
+			if link == "[" {
+				pr.RegisterAdvance()
+				p.Advance()
+			}
+			pr.Register(p.SkipNewLines())
+
+			p.Colons++
+			index := pr.Register(p.Exp())
+			p.Colons--
+			var to interface{} = nil
 			if pr.Error != nil {
 				return pr
 			}
+
 			pr.Register(p.SkipNewLines())
 
-			for p.CurrToken.Type == TTOp && p.CurrToken.Value == "," {
+			if p.CurrToken.Type == TTOp && p.CurrToken.Value == ":" {
 				pr.RegisterAdvance()
 				p.Advance()
+
 				pr.Register(p.SkipNewLines())
 
-				args = append(args, pr.Register(p.Exp()))
-				if pr.Error != nil {
-					return pr
+				to = pr.TryRegister(p.Exp())
+				if to == nil {
+					p.Reverse(pr.ToReverseCount)
 				}
+
 				pr.Register(p.SkipNewLines())
 			}
 
-			if p.CurrToken.Type != TTOp && p.CurrToken.Value != ")" {
+			if p.CurrToken.Type != TTOp || p.CurrToken.Value != "]" {
 				return pr.Failure(NewInvalidSyntaxError(
-					"Expected ')'",
-					p.CurrToken.StartPos,
-					p.CurrToken.EndPos))
+					"Expected ']'", p.CurrToken.StartPos, p.CurrToken.EndPos))
 			}
 
+			endPos := p.CurrToken.EndPos
+
 			pr.RegisterAdvance()
 			p.Advance()
 
-			return pr.Success(NewFunCallNode(atom, args))
-		}
-	}
-
-	if p.CurrToken.Type == TTOp && p.CurrToken.Value == "[" {
-		pr.RegisterAdvance()
-		p.Advance()
-		pr.Register(p.SkipNewLines()) 
-
-		index := pr.Register(p.Exp())
-		var to interface{} = nil
-		if pr.Error != nil {
-			return pr
-		}
+			access := NewElementAccessNode(node, index, to, startPos, endPos)
+			access.Optional, access.Chained = optional, chained
+			node = access
+		} else if link == "." {
+			if p.CurrToken.Type != TTId {
+				return pr.Failure(NewInvalidSyntaxError(
+					"Expected a field name after '.'", p.CurrToken.StartPos, p.CurrToken.EndPos))
+			}
 
-		pr.Register(p.SkipNewLines())
+			field := p.CurrToken
 
-		if p.CurrToken.Type == TTOp && p.CurrToken.Value == ":" {
 			pr.RegisterAdvance()
 			p.Advance()
 
-			pr.Register(p.SkipNewLines())
-
-			to = pr.TryRegister(p.Exp())
-			if to == nil {
-				p.Reverse(pr.ToReverseCount)
-			}
-
-			pr.Register(p.SkipNewLines())
-		}
-
-		if p.CurrToken.Type != TTOp && p.CurrToken.Value != "]" {
-			return pr.Failure(NewInvalidSyntaxError(
-				"Expected ']'", p.CurrToken.StartPos, p.CurrToken.EndPos))
+			access := NewElementAccessNode(node, NewStringNode(field), nil, startPos, field.EndPos)
+			access.Optional, access.Chained = optional, chained
+			node = access
+		} else {
+			break
 		}
-
-		pr.RegisterAdvance()
-		p.Advance()
-
-		return pr.Success(NewElementAccessNode(atom, index, to))
 	}
 
-	return pr.Success(atom)
+	return pr.Success(node)
 }
 
 func (p *Parser) Atom() *ParseResult {
@@ -878,11 +2309,9 @@ func (p *Parser) Atom() *ParseResult {
 		p.Advance()
 		return pr.Success(NewNullNode(t))
 	} else if t.Type == TTId {
-		node := pr.Register(p.AccessOrAssign())
-		if pr.Error != nil {
-			return pr
-		}
-		return pr.Success(node)
+		pr.RegisterAdvance()
+		p.Advance()
+		return pr.Success(NewVarAccessNode(t))
 	} else if t.Type == TTOp && t.Value == "[" {
 		list := pr.Register(p.ListExp())
 		if pr.Error != nil {
@@ -901,6 +2330,18 @@ func (p *Parser) Atom() *ParseResult {
 			return pr
 		}
 		return pr.Success(whileExp)
+	} else if t.Type == TTKeyword && t.Value == "loop" {
+		loopExp := pr.Register(p.LoopExp())
+		if pr.Error != nil {
+			return pr
+		}
+		return pr.Success(loopExp)
+	} else if t.Type == TTKeyword && t.Value == "do" {
+		doWhileExp := pr.Register(p.DoWhileExp())
+		if pr.Error != nil {
+			return pr
+		}
+		return pr.Success(doWhileExp)
 	} else if t.Type == TTKeyword && t.Value == "for" {
 		forExp := pr.Register(p.ForExp())
 		if pr.Error != nil {
@@ -913,6 +2354,18 @@ func (p *Parser) Atom() *ParseResult {
 			return pr
 		}
 		return pr.Success(eachExp)
+	} else if t.Type == TTOp && t.Value == "{" {
+		mapExp := pr.Register(p.MapExp())
+		if pr.Error != nil {
+			return pr
+		}
+		return pr.Success(mapExp)
+	} else if t.Type == TTKeyword && t.Value == "match" {
+		matchExp := pr.Register(p.MatchExp())
+		if pr.Error != nil {
+			return pr
+		}
+		return pr.Success(matchExp)
 	} else if t.Type == TTKeyword && t.Value == "fun" {
 		funDef := pr.Register(p.FunDef())
 		if pr.Error != nil {
@@ -930,15 +2383,38 @@ func (p *Parser) Atom() *ParseResult {
 		t.EndPos))
 }
 
+// Power parses '^' as right associative, its right side is parsed by Factor
+// so it can hold another power or a unary operator (2^3^2 == 2^9, 2^-1)
 func (p *Parser) Power() *ParseResult {
-	return p.BinOp(p.Call, p.Factor, TTOp, []string{"^"})
+	pr := NewParseResult()
+
+	base := pr.Register(p.Call())
+	if pr.Error != nil {
+		return pr
+	}
+
+	if p.CurrToken.Type != TTOp || p.CurrToken.Value != "^" {
+		return pr.Success(base)
+	}
+
+	op := p.CurrToken
+	pr.RegisterAdvance()
+	p.Advance()
+	pr.Register(p.SkipNewLines())
+
+	exponent := pr.Register(p.Factor())
+	if pr.Error != nil {
+		return pr
+	}
+
+	return pr.Success(NewBinNode(base, exponent, op))
 }
 
 func (p *Parser) Factor() *ParseResult {
 	pr := NewParseResult()
 	t := p.CurrToken
 
-	if t.Type == TTOp && t.Value == "+" || t.Value == "-" {
+	if t.Type == TTOp && (t.Value == "+" || t.Value == "-") {
 		pr.RegisterAdvance()
 		p.Advance()
 		fc := pr.Register(p.Factor())
@@ -955,68 +2431,35 @@ func (p *Parser) Term() *ParseResult {
 	return p.BinOp(p.Factor, p.Factor, TTOp, []string{"*", "/", "%"})
 }
 
-func (p *Parser) AccessOrAssign() *ParseResult {
-	pr := NewParseResult()
-
-	if p.CurrToken.Type != TTId {
-		return pr.Failure(NewInvalidSyntaxError("Expected identifier",
-			p.CurrToken.StartPos, p.CurrToken.EndPos))
-	}
-
-	name := p.CurrToken
-
-	pr.RegisterAdvance()
-	p.Advance()
-
-	tokenIndex := p.TokenIndex
-	if p.CurrToken.Type == TTOp && p.CurrToken.Value == "[" {
-		pr.RegisterAdvance()
-		p.Advance()
-
-		index := pr.Register(p.Exp())
-		if pr.Error != nil {
-			return pr
-		}
-		if p.CurrToken.Type != TTOp && p.CurrToken.Value != "]" {
-			return pr.Failure(NewInvalidSyntaxError(
-				"Expected ']'", p.CurrToken.StartPos, p.CurrToken.EndPos))
-		}
-		pr.RegisterAdvance()
-		p.Advance()
-		if p.CurrToken.Type == TTOp && p.CurrToken.Value == "=" {
-			pr.RegisterAdvance()
-			p.Advance()
-			exp := pr.Register(p.Exp())
-
-			if pr.Error != nil {
-				return pr
-			}
-
-			return pr.Success(NewElementAssignNode(name, index, exp))
-		}
-	}
-
-	if p.CurrToken.Type == TTOp && p.CurrToken.Value == "=" {
-		pr.RegisterAdvance()
-		p.Advance()
-		exp := pr.Register(p.Exp())
-
-		if pr.Error != nil {
-			return pr
-		}
-
-		return pr.Success(NewVarAssignNode(name, exp))
-	}
-
-	p.Reverse(p.TokenIndex - tokenIndex)
+func (p *Parser) OrExp() *ParseResult {
+	return p.BinOp(p.AndExp, p.AndExp, TTKeyword, []string{"or"})
+}
 
-	return pr.Success(NewVarAccessNode(name))
+func (p *Parser) AndExp() *ParseResult {
+	return p.BinOp(p.CompExp, p.CompExp, TTKeyword, []string{"and"})
 }
 
+// Exp parses an expression, operators from the loosest to the tightest:
+//
+//   cond ? a : b          ternary (right associative)
+//   ??                    null coalescing
+//   or
+//   and
+//   not
+//   == != < <= > >= is    comparisons and type checks
+//   .. ..<                ranges
+//   + -
+//   * / %
+//   + - (unary)
+//   ^                     power (right associative)
+//   f() xs[i] m.field     calls, indexing and fields
+//
+// All binary operators except '^' are left associative, and operands are
+// always evaluated from left to right
 func (p *Parser) Exp() *ParseResult {
 	pr := NewParseResult()
 
-	node := pr.Register(p.BinOp(p.CompExp, p.CompExp, TTKeyword, []string{"and", "or"}))
+	node := pr.Register(p.BinOp(p.OrExp, p.OrExp, TTOp, []string{"??"}))
 
 	if pr.Error != nil {
 		return pr
@@ -1026,7 +2469,9 @@ func (p *Parser) Exp() *ParseResult {
 		pr.RegisterAdvance()
 		p.Advance()
 
+		p.Colons++
 		left := pr.Register(p.Exp())
+		p.Colons--
 		if pr.Error != nil {
 			return pr
 		}
@@ -1074,10 +2519,59 @@ func (p *Parser) CompExp() *ParseResult {
 		return pr.Success(NewUnaryOpNode(op, node))
 	}
 
-	node := pr.Register(p.BinOp(p.ArithExp, p.ArithExp, TTOp, []string{"==", "!=", ">", ">=", "<", "<="}))
+	node := pr.Register(p.RangeExp())
+	if pr.Error != nil {
+		return pr
+	}
+
+	// 'is' is a comparison too, it chains with the others from left to right
+	// like in `x is num == true`
+	for {
+		if is := pr.Register(p.NextOp(TTKeyword, []string{"is"})); is != nil {
+			typ := pr.Register(p.Type())
+			if pr.Error != nil {
+				return pr
+			}
+			node = NewIsNode(node, typ.(*TypeNode))
+			continue
+		}
+
+		op := pr.Register(p.NextOp(TTOp, []string{"==", "!=", ">", ">=", "<", "<="}))
+		if op == nil {
+			break
+		}
+
+		right := pr.Register(p.RangeExp())
+		if pr.Error != nil {
+			return pr
+		}
+		node = NewBinNode(node, right, op.(*Token))
+	}
+
+	return pr.Success(node)
+}
+
+func (p *Parser) RangeExp() *ParseResult {
+	pr := NewParseResult()
+
+	node := pr.Register(p.ArithExp())
 	if pr.Error != nil {
 		return pr
 	}
+
+	if p.CurrToken.Type == TTOp && (p.CurrToken.Value == ".." || p.CurrToken.Value == "..<") {
+		op := p.CurrToken
+		pr.RegisterAdvance()
+		p.Advance()
+
+		end := pr.Register(p.ArithExp())
+		if pr.Error != nil {
+			return pr
+		}
+
+		node = NewBinNode(node, end, op)
+	}
+
 	return pr.Success(node)
 }
 
@@ -1085,30 +2579,62 @@ func (p *Parser) ArithExp() *ParseResult {
 	return p.BinOp(p.Term, p.Term, TTOp, []string{"+", "-"})
 }
 
-func (p *Parser) BinOp(rf, lf func() *ParseResult, opType string, ops []string) *ParseResult {
+// NextOp parses one of the operators of a binary operator chain and the new
+// lines around it, the operator can start a new line except for '+' and '-'
+// which start a new statement with a unary operator instead. It succeeds with
+// no node when the chain ends
+func (p *Parser) NextOp(opType string, ops []string) *ParseResult {
 	pr := NewParseResult()
-  r := pr.Register(rf())
 
-	if pr.Error != nil {
-		return pr
+	newLines := 0
+	for p.PeekToken(newLines).Type == TTNewLine {
+		newLines += 1
 	}
 
-	pr.Register(p.SkipNewLines())
+	next := p.PeekToken(newLines)
+	if next.Type != opType || !Contains(ops, next.Value) {
+		return pr.Success(nil)
+	}
+	if newLines > 0 && (next.Value == "+" || next.Value == "-") {
+		return pr.Success(nil)
+	}
 
-	for p.CurrToken.Type == opType && Contains(ops, p.CurrToken.Value) {
-		op := p.CurrToken
+	for ; newLines > 0; newLines-- {
 		pr.RegisterAdvance()
 		p.Advance()
-		pr.Register(p.SkipNewLines())
+	}
+
+	op := p.CurrToken
+	pr.RegisterAdvance()
+	p.Advance()
+	pr.Register(p.SkipNewLines())
+
+	return pr.Success(op)
+}
+
+// BinOp parses a left associative chain of binary operators
+func (p *Parser) BinOp(lf, rf func() *ParseResult, opType string, ops []string) *ParseResult {
+	pr := NewParseResult()
+	left := pr.Register(lf())
+
+	if pr.Error != nil {
+		return pr
+	}
+
+	for {
+		op := pr.Register(p.NextOp(opType, ops))
+		if op == nil {
+			break
+		}
 
-		l := pr.Register(lf())
+		right := pr.Register(rf())
 
 		if pr.Error != nil {
 			return pr
 		}
 
-		r = NewBinNode(r, l, op)
+		left = NewBinNode(left, right, op.(*Token))
 	}
 
-	return pr.Success(r)
+	return pr.Success(left)
 }
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+// sexp writes the operators of an expression as s-expressions, so the tests
+// can tell how it was grouped
+func sexp(node interface{}) string {
+	switch n := node.(type) {
+	case *NumberNode:
+		return fmt.Sprint(n.Token.Value)
+	case *VarAccessNode:
+		return n.NameToken.Value.(string)
+	case *BinOpNode:
+		return fmt.Sprintf("(%v %v %v)", n.Op.Value, sexp(n.Left), sexp(n.Right))
+	case *UnaryOpNode:
+		return fmt.Sprintf("(%v %v)", n.Op.Value, sexp(n.Node))
+	case *TernOpNode:
+		return fmt.Sprintf("(? %v %v %v)", sexp(n.Cond), sexp(n.Left), sexp(n.Right))
+	case *IsNode:
+		return fmt.Sprintf("(is %v %v)", sexp(n.Node), n.Type)
+	}
+	return fmt.Sprintf("<%T>", node)
+}
+
+func TestPrecedence(t *testing.T) {
+	for _, c := range []struct {
+		Exp, Want string
+	}{
+		// Power is right associative and binds tighter than unary minus
+		{"2 ^ 3 ^ 2", "(^ 2 (^ 3 2))"},
+		{"-2 ^ 2", "(- (^ 2 2))"},
+		{"2 ^ -1", "(^ 2 (- 1))"},
+		{"-a * b", "(* (- a) b)"},
+
+		// Arithmetic is left associative, '*' binds tighter than '+'
+		{"1 - 2 - 3", "(- (- 1 2) 3)"},
+		{"1 + 2 * 3", "(+ 1 (* 2 3))"},
+		{"8 / 4 % 3", "(% (/ 8 4) 3)"},
+
+		// Ranges take whole sums and sit below comparisons
+		{"1..2+1", "(.. 1 (+ 2 1))"},
+		{"0..<n-1", "(..< 0 (- n 1))"},
+		{"a < b == c", "(== (< a b) c)"},
+		{"1 is num == 1", "(== (is 1 num) 1)"},
+		{"a == b is num", "(is (== a b) num)"},
+		{"a + 1 is num", "(is (+ a 1) num)"},
+		{"not a is str", "(not (is a str))"},
+
+		// not binds looser than comparisons, and tighter than and/or
+		{"not a == b", "(not (== a b))"},
+		{"not a and b", "(and (not a) b)"},
+		{"a or b and c", "(or a (and b c))"},
+		{"a and b or c and d", "(or (and a b) (and c d))"},
+
+		// ?? sits above or, the ternary is the loosest and right associative
+		{"a ?? b or c", "(?? a (or b c))"},
+		{"a ?? b ?? c", "(?? (?? a b) c)"},
+		{"a or b ? 1 + 2 : c", "(? (or a b) (+ 1 2) c)"},
+		{"a ? b : c ? d : e", "(? a b (? c d e))"},
+	} {
+		ast, err := Parse("<test>", c.Exp)
+		if err != nil {
+			t.Errorf("%v: %v", c.Exp, err)
+			continue
+		}
+		stmts := ast.(*ListNode).Elements
+		if got := sexp(stmts[0]); len(stmts) != 1 || got != c.Want {
+			t.Errorf("%v parsed as %v, want %v", c.Exp, got, c.Want)
+		}
+	}
+}
@@ -0,0 +1,398 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"runtime/metrics"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ActiveProfile records where the time of the running program goes while it
+// runs with `--profile`, calls and loops push frames on it and whatever
+// happens between two changes of the stack is charged to the frame on top
+var ActiveProfile *Profile
+
+// profileNode is a frame of the call tree, there's a node for every
+// different stack a function or a loop ran in
+type profileNode struct {
+	Name string
+	Parent *profileNode
+	Children map[string]*profileNode
+	// Order keeps the children in the order they first ran
+	Order []*profileNode
+	Calls int
+	Self time.Duration
+	Allocs uint64
+}
+
+func (n *profileNode) child(name string) *profileNode {
+	node, ok := n.Children[name]
+	if !ok {
+		node = &profileNode{Name: name, Parent: n, Children: map[string]*profileNode{}}
+		n.Children[name] = node
+		n.Order = append(n.Order, node)
+	}
+	return node
+}
+
+// Stack returns the names of the frames from the root to the node
+func (n *profileNode) Stack() []string {
+	if n.Parent == nil {
+		return []string{n.Name}
+	}
+	return append(n.Parent.Stack(), n.Name)
+}
+
+type Profile struct {
+	Program string
+	// Out is where the stacks are written when the program ends, as folded
+	// stacks or as a pprof profile when it ends with .pb.gz
+	Out string
+	Root *profileNode
+	Stack []*profileNode
+	Start time.Time
+	Duration time.Duration
+
+	last time.Time
+	lastAllocs uint64
+	allocs []metrics.Sample
+}
+
+func NewProfile(program, out string) *Profile {
+	root := &profileNode{Name: "<root>", Calls: 1, Children: map[string]*profileNode{}}
+	p := &Profile{
+		Program: program,
+		Out: out,
+		Root: root,
+		Stack: []*profileNode{root},
+		allocs: []metrics.Sample{{Name: "/gc/heap/allocs:bytes"}},
+	}
+	p.Start, p.last, p.lastAllocs = time.Now(), time.Now(), p.readAllocs()
+	return p
+}
+
+// readAllocs returns how many bytes were allocated so far, or 0 when the
+// runtime can't tell
+func (p *Profile) readAllocs() uint64 {
+	metrics.Read(p.allocs)
+	if p.allocs[0].Value.Kind() != metrics.KindUint64 {
+		return 0
+	}
+	return p.allocs[0].Value.Uint64()
+}
+
+// tick charges the time and the allocations since the last change of the
+// stack to the frame on top of it
+func (p *Profile) tick() {
+	now, allocs := time.Now(), p.readAllocs()
+	top := p.Stack[len(p.Stack) - 1]
+	top.Self += now.Sub(p.last)
+	top.Allocs += allocs - p.lastAllocs
+	p.last, p.lastAllocs = now, allocs
+}
+
+// Enter pushes a call of a function or a run of a loop
+func (p *Profile) Enter(name string) {
+	p.tick()
+	node := p.Stack[len(p.Stack) - 1].child(name)
+	node.Calls++
+	p.Stack = append(p.Stack, node)
+}
+
+// Exit pops the frame pushed by the last Enter
+func (p *Profile) Exit() {
+	p.tick()
+	p.Stack = p.Stack[:len(p.Stack) - 1]
+}
+
+// Frame returns the frame of name on top of the stack without counting it
+// as a call, it's where a generator's body runs
+func (p *Profile) Frame(name string) *profileNode {
+	return p.Stack[len(p.Stack) - 1].child(name)
+}
+
+// Resume pushes the frames of a generator that's about to run and returns
+// the depth to suspend them from
+func (p *Profile) Resume(frames []*profileNode) int {
+	p.tick()
+	depth := len(p.Stack)
+	p.Stack = append(p.Stack, frames...)
+	return depth
+}
+
+// Suspend pops the frames of a generator that paused at a yield, so the code
+// that gets its value doesn't run inside of them
+func (p *Profile) Suspend(depth int) []*profileNode {
+	p.tick()
+	frames := append([]*profileNode{}, p.Stack[depth:]...)
+	p.Stack = p.Stack[:depth]
+	return frames
+}
+
+// StartProfile starts profiling the program that's about to run
+func StartProfile(program, out string) {
+	ActiveProfile = NewProfile(program, out)
+}
+
+// StopProfile stops the active profile and reports it, it's called when the
+// program ends or exits
+func StopProfile() {
+	p := ActiveProfile
+	if p == nil {
+		return
+	}
+	ActiveProfile = nil
+	p.tick()
+	p.Duration = time.Since(p.Start)
+
+	p.WriteSummary(os.Stderr)
+	if p.Out == "" {
+		return
+	}
+	file, err := os.Create(p.Out)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Failed to write the profile to", p.Out)
+		return
+	}
+	defer file.Close()
+	if strings.HasSuffix(p.Out, ".pb.gz") {
+		err = p.WritePprof(file)
+	} else {
+		err = p.WriteFolded(file)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Failed to write the profile to", p.Out)
+	}
+}
+
+// walk visits the nodes of the call tree, parents before their children
+func (p *Profile) walk(visit func(*profileNode)) {
+	var walk func(*profileNode)
+	walk = func(n *profileNode) {
+		visit(n)
+		for _, child := range n.Order {
+			walk(child)
+		}
+	}
+	walk(p.Root)
+}
+
+// WriteFolded writes the self time of every stack in microseconds, one stack
+// per line with its frames separated by ';', which flame graph tools read
+func (p *Profile) WriteFolded(out io.Writer) error {
+	var err error
+	p.walk(func(n *profileNode) {
+		if us := n.Self.Microseconds(); us > 0 && err == nil {
+			_, err = fmt.Fprintf(out, "%v %v\n", strings.Join(n.Stack(), ";"), us)
+		}
+	})
+	return err
+}
+
+type profileStat struct {
+	Name string
+	Calls int
+	Self, Total time.Duration
+	Allocs uint64
+}
+
+// Stats sums the nodes of every function and loop, the total time of a
+// recursive function only counts its outermost calls
+func (p *Profile) Stats() []*profileStat {
+	stats := map[string]*profileStat{}
+	list := []*profileStat{}
+	active := map[string]int{}
+
+	var walk func(*profileNode) time.Duration
+	walk = func(n *profileNode) time.Duration {
+		outer := active[n.Name] == 0
+		active[n.Name]++
+		total := n.Self
+		for _, child := range n.Order {
+			total += walk(child)
+		}
+		active[n.Name]--
+
+		stat, ok := stats[n.Name]
+		if !ok {
+			stat = &profileStat{Name: n.Name}
+			stats[n.Name] = stat
+			list = append(list, stat)
+		}
+		stat.Calls += n.Calls
+		stat.Self += n.Self
+		stat.Allocs += n.Allocs
+		if outer {
+			stat.Total += total
+		}
+		return total
+	}
+	walk(p.Root)
+
+	sort.SliceStable(list, func(i, j int) bool {
+		return list[i].Self > list[j].Self
+	})
+	return list
+}
+
+func formatBytes(n uint64) string {
+	switch {
+	case n >= 1 << 30:
+		return fmt.Sprintf("%.1fGB", float64(n) / (1 << 30))
+	case n >= 1 << 20:
+		return fmt.Sprintf("%.1fMB", float64(n) / (1 << 20))
+	case n >= 1 << 10:
+		return fmt.Sprintf("%.1fKB", float64(n) / (1 << 10))
+	}
+	return fmt.Sprintf("%vB", n)
+}
+
+// WriteSummary prints the functions and loops that took the most time
+func (p *Profile) WriteSummary(out io.Writer) {
+	const maxRows = 25
+
+	percent := func(d time.Duration) float64 {
+		if p.Duration == 0 {
+			return 0
+		}
+		return float64(d) * 100 / float64(p.Duration)
+	}
+	duration := func(d time.Duration) string {
+		return d.Round(time.Microsecond).String()
+	}
+
+	fmt.Fprintf(out, "\nProfile of %v, ran for %v\n\n", p.Program, duration(p.Duration))
+	fmt.Fprintf(out, "%10v %12v %7v %12v %7v %10v  %v\n", "calls", "self", "", "total", "", "allocs", "name")
+	for i, stat := range p.Stats() {
+		if i == maxRows {
+			fmt.Fprintln(out, "...")
+			break
+		}
+		fmt.Fprintf(out, "%10v %12v %6.1f%% %12v %6.1f%% %10v  %v\n",
+			stat.Calls, duration(stat.Self), percent(stat.Self),
+			duration(stat.Total), percent(stat.Total), formatBytes(stat.Allocs), stat.Name)
+	}
+}
+
+// protoBuffer encodes the few protocol buffer fields a pprof profile needs
+type protoBuffer struct {
+	bytes.Buffer
+}
+
+func (b *protoBuffer) varint(x uint64) {
+	for x >= 0x80 {
+		b.WriteByte(byte(x) | 0x80)
+		x >>= 7
+	}
+	b.WriteByte(byte(x))
+}
+
+func (b *protoBuffer) uint(field int, x uint64) {
+	b.varint(uint64(field) << 3)
+	b.varint(x)
+}
+
+func (b *protoBuffer) message(field int, msg *protoBuffer) {
+	b.varint(uint64(field) << 3 | 2)
+	b.varint(uint64(msg.Len()))
+	b.Write(msg.Bytes())
+}
+
+func (b *protoBuffer) string(field int, str string) {
+	b.varint(uint64(field) << 3 | 2)
+	b.varint(uint64(len(str)))
+	b.WriteString(str)
+}
+
+// pprof drops what's inside angle brackets from function names, so <root>
+// and the loops are named with square brackets there
+var pprofNames = strings.NewReplacer("<", "[", ">", "]")
+
+// WritePprof writes the profile in the gzipped protocol buffer format of
+// pprof, with the calls, the time and the allocations of every stack
+func (p *Profile) WritePprof(out io.Writer) error {
+	strs := []string{""}
+	strIds := map[string]uint64{"": 0}
+	str := func(s string) uint64 {
+		id, ok := strIds[s]
+		if !ok {
+			id = uint64(len(strs))
+			strs = append(strs, s)
+			strIds[s] = id
+		}
+		return id
+	}
+
+	prof := &protoBuffer{}
+	valueType := func(field int, typ, unit string) {
+		vt := &protoBuffer{}
+		vt.uint(1, str(typ))
+		vt.uint(2, str(unit))
+		prof.message(field, vt)
+	}
+	valueType(1, "calls", "count")
+	valueType(1, "time", "nanoseconds")
+	valueType(1, "alloc_space", "bytes")
+
+	// Every function or loop is a pprof function with a single location
+	// whose id is the same as the function's
+	funIds := map[string]uint64{}
+	funNames := []string{}
+	p.walk(func(n *profileNode) {
+		if _, ok := funIds[n.Name]; !ok {
+			funIds[n.Name] = uint64(len(funNames) + 1)
+			funNames = append(funNames, n.Name)
+		}
+
+		sample := &protoBuffer{}
+		for node := n; node != nil; node = node.Parent {
+			sample.uint(1, funIds[node.Name])
+		}
+		sample.uint(2, uint64(n.Calls))
+		sample.uint(2, uint64(n.Self.Nanoseconds()))
+		sample.uint(2, n.Allocs)
+		prof.message(2, sample)
+	})
+
+	for i := range funNames {
+		line := &protoBuffer{}
+		line.uint(1, uint64(i + 1))
+		loc := &protoBuffer{}
+		loc.uint(1, uint64(i + 1))
+		loc.message(4, line)
+		prof.message(4, loc)
+	}
+	for i, name := range funNames {
+		fun := &protoBuffer{}
+		fun.uint(1, uint64(i + 1))
+		fun.uint(2, str(pprofNames.Replace(name)))
+		fun.uint(3, str(name))
+		fun.uint(4, str(p.Program))
+		prof.message(5, fun)
+	}
+
+	timeType, nanoseconds := str("time"), str("nanoseconds")
+	defaultType := str("time")
+	for _, s := range strs {
+		prof.string(6, s)
+	}
+	prof.uint(9, uint64(p.Start.UnixNano()))
+	prof.uint(10, uint64(p.Duration.Nanoseconds()))
+	periodType := &protoBuffer{}
+	periodType.uint(1, timeType)
+	periodType.uint(2, nanoseconds)
+	prof.message(11, periodType)
+	prof.uint(12, 1)
+	prof.uint(14, defaultType)
+
+	gz := gzip.NewWriter(out)
+	if _, err := gz.Write(prof.Bytes()); err != nil {
+		return err
+	}
+	return gz.Close()
+}
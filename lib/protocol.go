@@ -0,0 +1,45 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// ReadMessage reads a message framed by a Content-Length header, which is how
+// both the language server and the debug adapter protocols send JSON
+func ReadMessage(in *bufio.Reader) ([]byte, error) {
+	length := -1
+	for {
+		line, err := in.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		line = strings.TrimSpace(line)
+		if line == "" {
+			break
+		}
+		if strings.HasPrefix(strings.ToLower(line), "content-length:") {
+			length, err = strconv.Atoi(strings.TrimSpace(line[len("content-length:"):]))
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	if length < 0 {
+		return nil, fmt.Errorf("missing Content-Length header")
+	}
+
+	content := make([]byte, length)
+	_, err := io.ReadFull(in, content)
+	return content, err
+}
+
+// WriteMessage writes a message as JSON framed by a Content-Length header
+func WriteMessage(out io.Writer, msg interface{}) {
+	content, _ := json.Marshal(msg)
+	fmt.Fprintf(out, "Content-Length: %v\r\n\r\n%s", len(content), content)
+}
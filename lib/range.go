@@ -0,0 +1,165 @@
+package main
+
+import (
+	"fmt"
+	"math"
+)
+
+type Range struct {
+	Start, End, Step float64
+	Inclusive bool
+	StartPos, EndPos *Position
+}
+
+func NewRange(s, e, st float64, inc bool) *Range {
+	r := &Range{
+		Start: s,
+		End: e,
+		Step: st,
+		Inclusive: inc,
+	}
+	return r
+}
+
+func (r *Range) String() string {
+	if r.Step != 1 {
+		return fmt.Sprintf("range(%v, %v, %v)", NewNumber(r.Start), NewNumber(r.End), NewNumber(r.Step))
+	}
+	if r.Inclusive {
+		return fmt.Sprintf("%v..%v", NewNumber(r.Start), NewNumber(r.End))
+	}
+	return fmt.Sprintf("%v..<%v", NewNumber(r.Start), NewNumber(r.End))
+}
+
+// Len returns the number of values in the range without walking it
+func (r *Range) Len() int {
+	steps := (r.End - r.Start) / r.Step
+	if steps < 0 {
+		return 0
+	}
+	if r.Inclusive {
+		return int(math.Floor(steps)) + 1
+	}
+	return int(math.Ceil(steps))
+}
+
+func (r *Range) At(index int) float64 {
+	return r.Start + float64(index) * r.Step
+}
+
+func (r *Range) SetPos(sp, ep *Position) Value {
+	r.StartPos = sp
+	r.EndPos = ep
+	if ep == nil {
+		endPos := *sp
+		endPos.Advance("")
+		r.EndPos = &endPos
+	}
+	return r
+}
+
+func (r *Range) AddTo(other interface{}) (Value, *Error) {
+	return nil, NewInvalidSyntaxError("Invalid '+' operation on a range", r.StartPos, r.EndPos)
+}
+
+func (r *Range) SubBy(other interface{}) (Value, *Error) {
+	return nil, NewInvalidSyntaxError("Invalid '-' operation on a range", r.StartPos, r.EndPos)
+}
+
+func (r *Range) MulBy(other interface{}) (Value, *Error) {
+	return nil, NewInvalidSyntaxError("Invalid '*' operation on a range", r.StartPos, r.EndPos)
+}
+
+func (r *Range) DivBy(other interface{}) (Value, *Error) {
+	return nil, NewInvalidSyntaxError("Invalid '/' operation on a range", r.StartPos, r.EndPos)
+}
+
+func (r *Range) Mod(other interface{}) (Value, *Error) {
+	return nil, NewInvalidSyntaxError("Invalid '%' operation on a range", r.StartPos, r.EndPos)
+}
+
+func (r *Range) Pow(other interface{}) (Value, *Error) {
+	return nil, NewInvalidSyntaxError("Invalid '^' operation on a range", r.StartPos, r.EndPos)
+}
+
+func (r *Range) IsEqualTo(other interface{}) Value {
+	if o, ok := other.(*Range); ok {
+		if r.Start == o.Start && r.End == o.End && r.Step == o.Step && r.Inclusive == o.Inclusive {
+			return NewNumber(1)
+		}
+	}
+	return NewNumber(0)
+}
+
+func (r *Range) IsNotEqualTo(other interface{}) Value {
+	return r.IsEqualTo(other).Not()
+}
+
+func (r *Range) IsGreaterThan(other interface{}) (Value, *Error) {
+	return nil, NewInvalidSyntaxError("Can't compare ranges", r.StartPos, r.EndPos)
+}
+
+func (r *Range) IsGreaterThanOrEqual(other interface{}) (Value, *Error) {
+	return nil, NewRuntimeError("Can't compare ranges", r.StartPos, nil)
+}
+
+func (r *Range) IsLessThan(other interface{}) (Value, *Error) {
+	return nil, NewRuntimeError("Can't compare ranges", r.StartPos, nil)
+}
+
+func (r *Range) IsLessThanOrEqual(other interface{}) (Value, *Error) {
+	return nil, NewRuntimeError("Can't compare ranges", r.StartPos, nil)
+}
+
+func (r *Range) Not() Value {
+	if r.IsTrue() {
+		return NewNumber(0)
+	}
+	return NewNumber(1)
+}
+
+func (r *Range) IsTrue() bool {
+	return r.Len() > 0
+}
+
+func (r *Range) GetVal() interface{} {
+	return r
+}
+
+func (r *Range) Call(args []interface{}, ctx *Context) *RuntimeResult {
+	rr := NewRuntimeResult()
+	return rr.Failure(NewRuntimeError("Can't call a range", r.StartPos, r.EndPos))
+}
+
+func (r *Range) AccessElement(index int, to interface{}, ctx *Context) *RuntimeResult {
+	rr := NewRuntimeResult()
+	length := r.Len()
+
+	if t, ok := to.(int); ok {
+		if index < 0 || index > length || t < index || t > length {
+			return rr.Failure(NewRuntimeError(
+				fmt.Sprintf("Index out of range (%v:%v) with length of %v", index, t, length),
+				r.StartPos, r.EndPos))
+		}
+		return rr.Success(NewRange(r.At(index), r.At(t), r.Step, false))
+	}
+
+	if index >= 0 && length > index {
+		return rr.Success(NewNumber(r.At(index)))
+	}
+	return rr.Failure(NewRuntimeError(
+		fmt.Sprintf("Index out of range (%v) with length of %v", index, length),
+		r.StartPos, r.EndPos))
+}
+
+func (r *Range) Iter() (*Iterator, *Error) {
+	length := r.Len()
+	index := 0
+	return NewIterator("range", func() (Value, bool, *Error) {
+		if index >= length {
+			return nil, false, nil
+		}
+		index += 1
+		return NewNumber(r.At(index - 1)), true, nil
+	}), nil
+}
@@ -0,0 +1,262 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const ReplPrompt = "\033[33mLuminary %\033[37m "
+const ReplContinuePrompt = "\033[33m        ...\033[37m "
+
+const ReplHelp = `Enter Luminary code to run it, a line ending inside an unclosed block,
+call or list continues on the next line (an empty line runs it anyway).
+
+Commands:
+  :help          Show this help
+  :reset         Forget all the variables and functions defined so far
+  :load <file>   Run a file in the REPL
+  :ast <code>    Show the syntax tree of some code without running it
+  :time <code>   Run some code and show how long it took
+  :quit          Exit the REPL
+
+Keys: arrows move and browse the history, Tab completes names,
+Ctrl-C cancels the input and Ctrl-D exits.`
+
+type Repl struct {
+	Editor *LineEditor
+	HistoryFile string
+}
+
+func NewRepl() *Repl {
+	r := &Repl{
+		Editor: NewLineEditor(),
+	}
+	r.Editor.Complete = r.Complete
+
+	if home, err := os.UserHomeDir(); err == nil {
+		r.HistoryFile = filepath.Join(home, ".luminary_history")
+		r.LoadHistory()
+	}
+
+	return r
+}
+
+func (r *Repl) LoadHistory() {
+	content, err := os.ReadFile(r.HistoryFile)
+	if err != nil {
+		return
+	}
+	for _, line := range strings.Split(string(content), "\n") {
+		r.Editor.AddHistory(line)
+	}
+}
+
+// SaveHistory adds an entry to the history, multi-line entries are joined
+// using ';' so they can be recalled and edited as a single line
+func (r *Repl) SaveHistory(entry string) {
+	entry = strings.Join(strings.Split(entry, "\n"), "; ")
+	history := r.Editor.History
+	if len(history) > 0 && history[len(history) - 1] == entry {
+		return
+	}
+	r.Editor.AddHistory(entry)
+
+	if r.HistoryFile == "" {
+		return
+	}
+	f, err := os.OpenFile(r.HistoryFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	fmt.Fprintln(f, entry)
+}
+
+// Complete returns the global names and keywords starting with a word
+func (r *Repl) Complete(word string) []string {
+	names := []string{}
+	for name := range globalSymbolTable.Symbols {
+		if strings.HasPrefix(name, word) {
+			names = append(names, name)
+		}
+	}
+	for _, keyword := range Keywords {
+		if strings.HasPrefix(keyword, word) {
+			names = append(names, keyword)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// IsIncomplete reports whether some code needs more lines, which is when a
+// bracket is still open or the parser stopped at the end of the input
+func IsIncomplete(text string) bool {
+	tokens, err := NewLexer(text, "<stdin>", text).MakeTokens()
+	if err != nil {
+		// Strings can span many lines
+		return err.Incomplete
+	}
+
+	depth := 0
+	for _, tok := range tokens {
+		if tok.Type != TTOp {
+			continue
+		}
+		switch tok.Value {
+		case "(", "[", "{", "?[":
+			depth++
+		case ")", "]", "}":
+			depth--
+		}
+	}
+	if depth > 0 {
+		return true
+	}
+
+	ast := NewParser(tokens, -1).Parse()
+	if ast.Error == nil || ast.Error.StartPos == nil {
+		return false
+	}
+	eof := tokens[len(tokens) - 1]
+	return ast.Error.StartPos.Index >= eof.StartPos.Index
+}
+
+func (r *Repl) Start() {
+	for {
+		text, err := r.Read()
+		if err == ErrInterrupted {
+			continue
+		}
+		if err != nil {
+			if err != io.EOF {
+				fmt.Println(err)
+			}
+			break
+		}
+
+		if strings.TrimSpace(text) == "" {
+			continue
+		}
+		r.SaveHistory(text)
+
+		if strings.HasPrefix(strings.TrimSpace(text), ":") {
+			if !r.Command(strings.TrimSpace(text)) {
+				break
+			}
+			continue
+		}
+
+		r.Eval(text)
+	}
+}
+
+// Read reads an entry which can span many lines
+func (r *Repl) Read() (string, error) {
+	text, err := r.Editor.ReadLine(ReplPrompt)
+	if err != nil {
+		return "", err
+	}
+	if strings.HasPrefix(strings.TrimSpace(text), ":") {
+		return text, nil
+	}
+
+	for IsIncomplete(text) {
+		line, err := r.Editor.ReadLine(ReplContinuePrompt)
+		if err != nil {
+			return "", err
+		}
+		if strings.TrimSpace(line) == "" {
+			break
+		}
+		text += "\n" + line
+	}
+	return text, nil
+}
+
+// Eval runs some code and echoes the value of its last statement, unless it's
+// null or the statement only defines something, the value is kept in `_`
+func (r *Repl) Eval(text string) {
+	ast, err := Parse("<stdin>", text)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	res := Exec(ast)
+	if res.Error != nil {
+		fmt.Println(res.Error)
+		return
+	}
+
+	statements := ast.(*ListNode).Elements
+	values := res.Value.(*List).Elements
+	if len(statements) == 0 || len(values) != len(statements) {
+		return
+	}
+
+	val := values[len(values) - 1].(Value)
+	if _, isNull := val.(*Null); isNull || IsDefinition(statements[len(statements) - 1]) {
+		return
+	}
+
+	globalSymbolTable.Set("_", val)
+	fmt.Println(Repr(val))
+}
+
+// IsDefinition reports whether a statement assigns or defines something, or
+// is a loop, which the REPL doesn't echo
+func IsDefinition(node interface{}) bool {
+	switch n := node.(type) {
+	case *VarAssignNode, *LetNode, *CompoundAssignNode, *DestructureAssignNode, *ElementAssignNode:
+		return true
+	case *ForNode, *WhileNode, *WhileLetNode, *EachNode, *LoopNode, *DoWhileNode:
+		return true
+	case *FunDefNode:
+		return n.Name != ""
+	}
+	return false
+}
+
+// Command runs a meta command, it returns false when the REPL should exit
+func (r *Repl) Command(text string) bool {
+	name, arg := text, ""
+	if i := strings.IndexAny(text, " \t"); i != -1 {
+		name, arg = text[:i], strings.TrimSpace(text[i:])
+	}
+
+	switch name {
+	case ":help":
+		fmt.Println(ReplHelp)
+	case ":quit", ":exit":
+		return false
+	case ":reset":
+		globalSymbolTable = NewSymbolTable()
+		fmt.Println("The REPL has been reset")
+	case ":load":
+		if arg == "" {
+			fmt.Println("Usage: :load <file>")
+			break
+		}
+		RunFile(arg)
+	case ":ast":
+		ast, err := Parse("<stdin>", arg)
+		if err != nil {
+			fmt.Println(err)
+			break
+		}
+		fmt.Println(DumpAST(ast))
+	case ":time":
+		start := time.Now()
+		r.Eval(arg)
+		fmt.Println("Took", time.Since(start))
+	default:
+		fmt.Printf("Unknown command '%v', type :help to see the commands\n", name)
+	}
+	return true
+}
@@ -0,0 +1,55 @@
+package main
+
+import "strings"
+
+var reprEscapes = strings.NewReplacer("\\", "\\\\", "\"", "\\\"", "\n", "\\n", "\t", "\\t")
+
+// Repr formats a value the way it would be written in Luminary, so strings
+// are quoted and functions are marked as such
+func Repr(val Value) string {
+	switch v := val.(type) {
+	case *String:
+		return "\"" + reprEscapes.Replace(v.GetVal().(string)) + "\""
+	case *List:
+		str := "["
+		for i, el := range v.Elements {
+			if i != 0 {
+				str += ", "
+			}
+			str += Repr(el.(Value))
+		}
+		return str + "]"
+	case *Map:
+		str := "{"
+		for i, key := range v.Keys {
+			if i != 0 {
+				str += ", "
+			}
+			if IsIdentifier(key) {
+				str += key
+			} else {
+				str += "\"" + reprEscapes.Replace(key) + "\""
+			}
+			str += ": " + Repr(v.Values[key])
+		}
+		return str + "}"
+	case *Function:
+		return "<fun " + v.String() + ">"
+	case *BuiltinFunction:
+		return "<builtin fun " + strings.TrimPrefix(v.String(), "builtin:") + ">"
+	}
+	return val.String()
+}
+
+// IsIdentifier reports whether a string can be used as a name
+func IsIdentifier(str string) bool {
+	if str == "" || strings.Contains(Digits, str[:1]) || Contains(Keywords, str) || str == "null" {
+		return false
+	}
+	for _, c := range str {
+		if !strings.ContainsRune(IdAllowedChars, c) {
+			return false
+		}
+	}
+	return true
+}
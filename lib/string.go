@@ -138,31 +138,6 @@ func (s *String) IsLessThanOrEqual(other interface{}) (Value, *Error) {
 	return nil, NewRuntimeError("Can't compare values of different types", s.StartPos, nil)
 }
 
-func (s *String) And(other interface{}) (Value, *Error) {
-	if o, ok := other.(Value); ok {
-		if s.IsTrue() && o.IsTrue() {
-			return o, nil
-		}
-		return NewNumber(0), nil
-	}
-
-	return nil, NewRuntimeError("Can't compare values of different types", s.StartPos, nil)
-}
-
-func (s *String) Or(other interface{}) (Value, *Error) {
-	if o, ok := other.(Value); ok {
-		if s.IsTrue() {
-			return s, nil
-		}
-		if o.IsTrue() {
-			return o, nil
-		}
-		return NewNumber(0), nil
-	}
-
-	return nil, NewRuntimeError("Can't compare values of different types", s.StartPos, nil)
-}
-
 func (s *String) Not() Value {
 	if s.IsTrue() {
 		return NewNumber(0)
@@ -186,28 +161,36 @@ func (n *String) Call(args []interface{}, ctx *Context) *RuntimeResult {
 func (s *String) AccessElement(index int, to interface{}, ctx *Context) *RuntimeResult {
 	rr := NewRuntimeResult()
 
-	val := s.GetVal().(string)
+	// Indexes count characters, not bytes
+	val := []rune(s.GetVal().(string))
 	length := len(val)
 
 	if t, ok := to.(int); ok {
-		if length > index {
-			if length >= t {
-				return rr.Success(NewString(val[index:t]))
-			}
+		if index < 0 || index > length || t < index || t > length {
 			return rr.Failure(NewRuntimeError(
-				fmt.Sprintf("Index out of range (%v) with length of %v", t, length),
+				fmt.Sprintf("Index out of range (%v:%v) with length of %v", index, t, length),
 				s.StartPos, s.EndPos))
 		}
-		return rr.Failure(NewRuntimeError(
-			fmt.Sprintf("Index out of range (%v) with length of %v", index, length),
-			s.StartPos, s.EndPos))
+		return rr.Success(NewString(string(val[index:t])))
 	}
 
-	if length > index {
-		return rr.Success(NewString(val[index:index + 1]))
+	if index >= 0 && length > index {
+		return rr.Success(NewString(string(val[index:index + 1])))
 	}
 
 	return rr.Failure(NewRuntimeError(
 		fmt.Sprintf("Index out of range (%v) with length of %v", index, length),
 		s.StartPos, s.EndPos))
 }
+
+func (s *String) Iter() (*Iterator, *Error) {
+	runes := []rune(s.Value)
+	index := 0
+	return NewIterator("string", func() (Value, bool, *Error) {
+		if index >= len(runes) {
+			return nil, false, nil
+		}
+		index += 1
+		return NewString(string(runes[index - 1])), true, nil
+	}), nil
+}
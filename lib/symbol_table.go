@@ -35,8 +35,8 @@ func (st *SymbolTable) Init() {
 	st.Set("map", BuiltinMap)
 	st.Set("reduce", BuiltinReduce)
 	st.Set("filter", BuiltinFilter)
-	st.Set("min", BuiltinMax)
-	st.Set("max", BuiltinMin)
+	st.Set("min", BuiltinMin)
+	st.Set("max", BuiltinMax)
 
 	// Strings
 	st.Set("trim", BuiltinTrim)
@@ -44,6 +44,14 @@ func (st *SymbolTable) Init() {
 	st.Set("upper", BuiltinUpper)
 	st.Set("lower", BuiltinLower)
 
+	// Iterators
+	st.Set("range", BuiltinRange)
+	st.Set("zip", BuiltinZip)
+	st.Set("enumerate", BuiltinEnumerate)
+	st.Set("take", BuiltinTake)
+	st.Set("chain", BuiltinChain)
+	st.Set("list", BuiltinList)
+
 	// Numbers
 	st.Set("floor", BuiltinFloor)
 	st.Set("round", BuiltinRound)
@@ -52,6 +60,20 @@ func (st *SymbolTable) Init() {
 	// Conversion
 	st.Set("num", BuiltinNum)
 	st.Set("str", BuiltinStr)
+
+	// Types
+	st.Set("type", BuiltinType)
+	st.Set("is_num", BuiltinIsNum)
+	st.Set("is_str", BuiltinIsStr)
+	st.Set("is_list", BuiltinIsList)
+	st.Set("is_map", BuiltinIsMap)
+	st.Set("is_fun", BuiltinIsFun)
+	st.Set("is_null", BuiltinIsNull)
+
+	// Testing
+	st.Set("assert", BuiltinAssert)
+	st.Set("assert_eq", BuiltinAssertEq)
+	st.Set("assert_raises", BuiltinAssertRaises)
 }
 
 func (st *SymbolTable) Get(n string) Value {
@@ -0,0 +1,16 @@
+//go:build !linux
+// +build !linux
+
+package main
+
+import "errors"
+
+func IsTerminal(fd int) bool {
+	return false
+}
+
+// MakeRaw isn't supported outside of linux, the REPL falls back to reading
+// whole lines
+func MakeRaw(fd int) (func(), error) {
+	return nil, errors.New("raw mode is not supported on this platform")
+}
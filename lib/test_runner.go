@@ -0,0 +1,303 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// TestResult is the outcome of running a test function, Error is nil when it
+// passed
+type TestResult struct {
+	File, Name string
+	Error *Error
+	Duration time.Duration
+}
+
+func (r *TestResult) Failed() bool {
+	return r.Error != nil
+}
+
+// Message is the error of a failed test with the place it happened at
+func (r *TestResult) Message() string {
+	if r.Error == nil {
+		return ""
+	}
+	msg := r.Error.Name + ": " + r.Error.Details
+	if r.Error.StartPos != nil {
+		line, col := lintLocation(r.Error.StartPos)
+		msg = fmt.Sprintf("%v:%v:%v: %v", r.Error.StartPos.FileName, line, col, msg)
+	}
+	return msg
+}
+
+// TestFiles returns the files of paths and the *_test.lum files inside
+// directories
+func TestFiles(paths []string) []string {
+	files := []string{}
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil || !info.IsDir() {
+			files = append(files, path)
+			continue
+		}
+		for _, file := range LumFiles([]string{path}) {
+			if strings.HasSuffix(file, "_test.lum") {
+				files = append(files, file)
+			}
+		}
+	}
+	return files
+}
+
+// testNames returns the names of the test_* functions defined at the top of
+// a file in the order they're written
+func testNames(ast interface{}) []string {
+	names := []string{}
+	list, ok := ast.(*ListNode)
+	if !ok {
+		return names
+	}
+	for _, stmt := range list.Elements {
+		if fun, ok := stmt.(*FunDefNode); ok && strings.HasPrefix(fun.Name, "test_") {
+			names = append(names, fun.Name)
+		}
+	}
+	return names
+}
+
+// RunTests runs the tests of a file whose names match filter, each one runs
+// in a fresh global scope where the file has been run first, so a test can't
+// see the variables another test changed
+func RunTests(file string, filter *regexp.Regexp) ([]*TestResult, *Error) {
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return nil, NewRuntimeError("Failed to load file " + file, nil, nil)
+	}
+
+	ast, parseErr := Parse(file, string(content))
+	if parseErr != nil {
+		return nil, parseErr
+	}
+	if ActiveCoverage != nil {
+		ActiveCoverage.Add(file, ast)
+	}
+
+	results := []*TestResult{}
+	for _, name := range testNames(ast) {
+		if filter != nil && !filter.MatchString(name) {
+			continue
+		}
+
+		start := time.Now()
+		ctx := NewContext("<root>")
+		ctx.SymbolTable = NewSymbolTable()
+		res := NewInterpretor().Visit(ast, ctx)
+		if res.Error == nil {
+			res = ctx.SymbolTable.Get(name).Call([]interface{}{}, ctx)
+		}
+		results = append(results, &TestResult{file, name, res.Error, time.Since(start)})
+	}
+	return results, nil
+}
+
+// WriteTestText prints a line for every test and the errors of the failed
+// ones, then how many passed
+func WriteTestText(out io.Writer, results []*TestResult) {
+	failed := 0
+	for _, r := range results {
+		if !r.Failed() {
+			fmt.Fprintf(out, "ok   %v::%v (%v)\n", r.File, r.Name, r.Duration.Round(time.Microsecond))
+			continue
+		}
+		failed++
+		fmt.Fprintf(out, "FAIL %v::%v (%v)\n", r.File, r.Name, r.Duration.Round(time.Microsecond))
+		for _, line := range strings.Split(r.Message(), "\n") {
+			fmt.Fprintf(out, "    %v\n", line)
+		}
+	}
+	fmt.Fprintf(out, "\n%v passed, %v failed\n", len(results) - failed, failed)
+}
+
+// WriteTestTAP prints the results in the Test Anything Protocol
+func WriteTestTAP(out io.Writer, results []*TestResult) {
+	fmt.Fprintln(out, "TAP version 13")
+	fmt.Fprintf(out, "1..%v\n", len(results))
+	for i, r := range results {
+		if !r.Failed() {
+			fmt.Fprintf(out, "ok %v - %v::%v\n", i + 1, r.File, r.Name)
+			continue
+		}
+		fmt.Fprintf(out, "not ok %v - %v::%v\n", i + 1, r.File, r.Name)
+		fmt.Fprintln(out, "  ---")
+		fmt.Fprintf(out, "  message: |\n")
+		for _, line := range strings.Split(r.Error.Details, "\n") {
+			fmt.Fprintf(out, "    %v\n", line)
+		}
+		if r.Error.StartPos != nil {
+			line, col := lintLocation(r.Error.StartPos)
+			fmt.Fprintf(out, "  at: %v:%v:%v\n", r.Error.StartPos.FileName, line, col)
+		}
+		fmt.Fprintln(out, "  ...")
+	}
+}
+
+type junitFailure struct {
+	Type string `xml:"type,attr"`
+	Message string `xml:"message,attr"`
+	Text string `xml:",chardata"`
+}
+
+type junitCase struct {
+	Name string `xml:"name,attr"`
+	ClassName string `xml:"classname,attr"`
+	Time string `xml:"time,attr"`
+	Failure *junitFailure `xml:"failure,omitempty"`
+	Error *junitFailure `xml:"error,omitempty"`
+}
+
+type junitSuite struct {
+	Name string `xml:"name,attr"`
+	Tests int `xml:"tests,attr"`
+	Failures int `xml:"failures,attr"`
+	Errors int `xml:"errors,attr"`
+	Time string `xml:"time,attr"`
+	Cases []*junitCase `xml:"testcase"`
+}
+
+type junitSuites struct {
+	XMLName xml.Name `xml:"testsuites"`
+	Suites []*junitSuite `xml:"testsuite"`
+}
+
+// WriteTestJUnit prints the results as JUnit XML with a suite for every file,
+// failed assertions are failures and other errors are errors
+func WriteTestJUnit(out io.Writer, results []*TestResult) {
+	seconds := func(d time.Duration) string {
+		return fmt.Sprintf("%.3f", d.Seconds())
+	}
+
+	doc := &junitSuites{}
+	suites := map[string]*junitSuite{}
+	durations := map[string]time.Duration{}
+	for _, r := range results {
+		suite, ok := suites[r.File]
+		if !ok {
+			suite = &junitSuite{Name: r.File}
+			suites[r.File] = suite
+			doc.Suites = append(doc.Suites, suite)
+		}
+
+		c := &junitCase{Name: r.Name, ClassName: strings.TrimSuffix(filepath.ToSlash(r.File), ".lum"), Time: seconds(r.Duration)}
+		if r.Failed() {
+			summary := strings.SplitN(r.Error.Details, "\n", 2)[0]
+			failure := &junitFailure{r.Error.Name, summary, r.Message()}
+			if r.Error.Name == "Assertion Error" {
+				c.Failure = failure
+				suite.Failures++
+			} else {
+				c.Error = failure
+				suite.Errors++
+			}
+		}
+		suite.Tests++
+		suite.Cases = append(suite.Cases, c)
+		durations[r.File] += r.Duration
+		suite.Time = seconds(durations[r.File])
+	}
+
+	fmt.Fprint(out, xml.Header)
+	enc := xml.NewEncoder(out)
+	enc.Indent("", "  ")
+	enc.Encode(doc)
+	fmt.Fprintln(out)
+}
+
+// TestCommand runs the tests of files and directories (the current directory
+// by default) and prints the results as text, TAP or JUnit XML. `--run
+// pattern` only runs the tests whose names match the pattern and
+// `--coverage` reports which lines the tests ran, it reports whether every
+// test passed
+func TestCommand(args []string) bool {
+	format := "text"
+	var filter *regexp.Regexp
+	coverage, coverageOut := false, ""
+	paths := []string{}
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--coverage" {
+			coverage = true
+			continue
+		}
+		if (arg == "--format" || arg == "--run" || arg == "--coverage-out") && i + 1 < len(args) {
+			i++
+			if arg == "--format" {
+				format = args[i]
+				continue
+			}
+			if arg == "--coverage-out" {
+				coverage, coverageOut = true, args[i]
+				continue
+			}
+			re, err := regexp.Compile(args[i])
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Invalid pattern '%v': %v\n", args[i], err)
+				os.Exit(2)
+			}
+			filter = re
+			continue
+		}
+		paths = append(paths, arg)
+	}
+	if format != "text" && format != "tap" && format != "junit" {
+		fmt.Fprintf(os.Stderr, "Unknown format '%v', expected text, tap or junit\n", format)
+		os.Exit(2)
+	}
+	if len(paths) == 0 {
+		paths = []string{"."}
+	}
+
+	// What the tests print goes to stderr so it doesn't break the reports
+	out := os.Stdout
+	if format != "text" {
+		os.Stdout = os.Stderr
+	}
+
+	if coverage {
+		StartCoverage(coverageOut)
+	}
+
+	ok := true
+	results := []*TestResult{}
+	for _, file := range TestFiles(paths) {
+		fileResults, err := RunTests(file, filter)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			ok = false
+			continue
+		}
+		results = append(results, fileResults...)
+	}
+
+	switch format {
+	case "tap":
+		WriteTestTAP(out, results)
+	case "junit":
+		WriteTestJUnit(out, results)
+	default:
+		WriteTestText(out, results)
+	}
+	StopCoverage()
+
+	for _, r := range results {
+		if r.Failed() {
+			ok = false
+		}
+	}
+	return ok
+}
@@ -19,11 +19,11 @@ type Token struct {
 }
 
 func NewToken(t string, v interface{}, sp, ep *Position) *Token {
+	startPos := *sp
 	token := &Token{
 		Type: t,
 		Value: v,
-		StartPos: sp,
-		EndPos: ep,
+		StartPos: &startPos,
 	}
 
 	if ep == nil {
@@ -31,6 +31,9 @@ func NewToken(t string, v interface{}, sp, ep *Position) *Token {
 		endPos.Index += 1
 		endPos.Col += 1
 		token.EndPos = &endPos
+	} else {
+		endPos := *ep
+		token.EndPos = &endPos
 	}
 
 	return token
@@ -0,0 +1,70 @@
+package main
+
+import "fmt"
+
+// EnforceTypes makes functions and let statements check their type
+// annotations against the values they get while running
+var EnforceTypes = false
+
+// TypeName returns the name of the type of a value as used in annotations
+func TypeName(val Value) string {
+	switch val.(type) {
+	case *Number:
+		return "num"
+	case *String:
+		return "str"
+	case *List:
+		return "list"
+	case *Map:
+		return "map"
+	case *Function, *BuiltinFunction:
+		return "fun"
+	case *Null:
+		return "null"
+	case *Range:
+		return "range"
+	case *Iterator:
+		return "iterator"
+	}
+	return "any"
+}
+
+// MatchesType reports whether a value fits a type annotation, the elements
+// of lists and the values of maps are checked too
+func MatchesType(val Value, t *TypeNode) bool {
+	if t == nil || t.Name == "any" {
+		return true
+	}
+	if _, isNull := val.(*Null); isNull && t.Nullable {
+		return true
+	}
+	if TypeName(val) != t.Name {
+		return false
+	}
+	if len(t.Args) == 0 {
+		return true
+	}
+
+	switch v := val.(type) {
+	case *List:
+		for _, el := range v.Elements {
+			if !MatchesType(el.(Value), t.Args[0]) {
+				return false
+			}
+		}
+	case *Map:
+		for _, key := range v.Keys {
+			if !MatchesType(v.Values[key], t.Args[0]) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func CheckValueType(what string, val Value, t *TypeNode, sp, ep *Position) *Error {
+	if MatchesType(val, t) {
+		return nil
+	}
+	return NewTypeError(fmt.Sprintf("Expected %v to be %v, got %v", what, t, TypeName(val)), sp, ep)
+}
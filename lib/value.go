@@ -15,11 +15,10 @@ type Value interface {
 	IsGreaterThanOrEqual(interface{}) (Value, *Error)
 	IsLessThan(interface{}) (Value, *Error)
 	IsLessThanOrEqual(interface{}) (Value, *Error)
-	And(interface{}) (Value, *Error)
-	Or(interface{}) (Value, *Error)
 	Not() Value
 	IsTrue() bool
 	GetVal() interface{}
 	Call(args []interface{}, ctx *Context) *RuntimeResult
 	AccessElement(index int, to interface{}, ctx *Context) *RuntimeResult
+	Iter() (*Iterator, *Error)
 }